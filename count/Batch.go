@@ -0,0 +1,349 @@
+/*
+count/Batch.go
+
+Scanning many repositories as one batch. Repositories are discovered
+below a directory, such as a mirror of an organization, or listed in a
+file. Each is scanned on its own with the same exclusions and options,
+then the results are combined into an aggregate Result whose top
+level directories are the repositories, so line counts by filetype and
+blame counts by author span all of them.
+*/
+
+package count
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A repository of a batch
+type BatchRepo struct {
+	// Unique slash separated name, the repository's directory in the
+	// aggregate result
+	Name string
+	// Path or URL the repository was found at
+	Target string
+	// Branch or revision scanned and the commit it resolved to, ""
+	// until scanned or outside of a repository
+	Branch string
+	Commit string
+	// nil until scanned, or if the repository couldn't be scanned
+	Result *Result
+	// Why the repository couldn't be cloned or scanned
+	Err error
+
+	scanner *Scanner
+}
+
+// Repositories scanned together, see NewBatch
+type Batch struct {
+	// Base name of the directory or list file the repositories came from
+	Name  string
+	Repos []*BatchRepo
+	// Counts and blame of every scanned repository together, as
+	// combined by the last Combine
+	Aggregate *Result
+
+	ignore  IgnoreConfig
+	options Options
+	clone   CloneOptions
+
+	// Status messages of every repository's scanner
+	status chan tea.Msg
+}
+
+// NewBatch creates a batch of the repositories below target if it is a
+// directory, or of the ones listed in target if it is a file, see
+// FindRepos and ReadRepoList. Repositories given by URL are cloned
+// into memory with clone when they are scanned.
+func NewBatch(target string, ignore IgnoreConfig, opts Options, clone CloneOptions) (*Batch, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	if info.IsDir() {
+		targets, err = FindRepos(target)
+	} else {
+		targets, err = ReadRepoList(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no git repositories found in %s", target)
+	}
+
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	b := &Batch{
+		Name:    filepath.Base(abs),
+		ignore:  ignore,
+		options: opts,
+		clone:   clone,
+		status:  make(chan tea.Msg),
+	}
+
+	// Discovered repositories are named by their path below the
+	// directory, listed ones by their base name
+	used := make(map[string]bool)
+	for _, t := range targets {
+		var name string
+		switch {
+		case IsRepoURL(t):
+			name = RepoName(t)
+		case info.IsDir():
+			name = relativeSlashPath(abs, t)
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(t), ".git")
+		}
+		unique := name
+		for i := 2; used[unique]; i++ {
+			unique = fmt.Sprintf("%s-%d", name, i)
+		}
+		used[unique] = true
+		b.Repos = append(b.Repos, &BatchRepo{Name: unique, Target: t})
+	}
+	return b, nil
+}
+
+// FindRepos returns the git repositories below dir, including bare
+// ones, in path order. Hidden directories aren't searched, nor are
+// repositories themselves, so submodules and nested checkouts are left
+// to the repository containing them.
+func FindRepos(dir string) ([]string, error) {
+	var repos []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if isRepoDir(p) {
+			repos = append(repos, p)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return repos, err
+}
+
+// isRepoDir reports whether dir is the work tree of a repository or a
+// bare repository.
+func isRepoDir(dir string) bool {
+	if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadRepoList reads the repositories listed in the file at name, one
+// path or URL per line. Blank lines and lines starting with # are
+// ignored, and relative paths are relative to the file's directory.
+func ReadRepoList(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var repos []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !IsRepoURL(line) && !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(name), line)
+		}
+		repos = append(repos, line)
+	}
+	return repos, scanner.Err()
+}
+
+// With returns a new batch of the same repositories with different
+// exclusions and options, none of them scanned yet. Repositories that
+// were cloned aren't cloned again.
+func (b *Batch) With(ignore IgnoreConfig, opts Options) *Batch {
+	batch := &Batch{
+		Name:    b.Name,
+		ignore:  ignore,
+		options: opts,
+		clone:   b.clone,
+		status:  b.status,
+	}
+	for _, repo := range b.Repos {
+		next := &BatchRepo{Name: repo.Name, Target: repo.Target}
+		if repo.scanner != nil {
+			next.scanner = repo.scanner.With(ignore, opts)
+			next.scanner.status = b.status
+		}
+		batch.Repos = append(batch.Repos, next)
+	}
+	return batch
+}
+
+// Status returns the channel status messages of every repository's
+// scanner are sent on, see Scanner.Status.
+func (b *Batch) Status() <-chan tea.Msg {
+	return b.status
+}
+
+// Scanner returns the scanner of the i-th repository, cloning it into
+// memory first if it was given by URL. Listed paths that aren't
+// directories are an error.
+func (b *Batch) Scanner(ctx context.Context, i int) (*Scanner, error) {
+	repo := b.Repos[i]
+	if repo.scanner != nil {
+		return repo.scanner, nil
+	}
+	if IsRepoURL(repo.Target) {
+		cloned, err := CloneRepo(ctx, repo.Target, b.clone)
+		if err != nil {
+			return nil, fmt.Errorf("clone %s: %w", repo.Target, err)
+		}
+		repo.scanner = NewRepoScanner(cloned, repo.Name, b.ignore, b.options)
+	} else {
+		info, err := os.Stat(repo.Target)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", repo.Target)
+		}
+		repo.scanner = NewScanner(repo.Target, b.ignore, b.options)
+	}
+	repo.scanner.status = b.status
+	return repo.scanner, nil
+}
+
+// Scan scans every repository in turn, then combines their results.
+// Repositories that can't be scanned are recorded in their Err, unless
+// the scan is strict in which case the first one stops the batch. If
+// ctx is done first, the repositories scanned so far are combined into
+// an incomplete aggregate along with the context's error.
+func (b *Batch) Scan(ctx context.Context) error {
+	var err error
+	for i := range b.Repos {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		scanner, scanErr := b.Scanner(ctx, i)
+		var res *Result
+		if scanErr == nil {
+			res, scanErr = scanner.Scan(ctx)
+		}
+		b.SetResult(i, res, scanErr)
+		if scanErr != nil && b.options.Strict && ctx.Err() == nil {
+			return fmt.Errorf("%s: %w", b.Repos[i].Name, scanErr)
+		}
+	}
+	b.Combine()
+	return err
+}
+
+// SetResult records the result of scanning the i-th repository, or
+// the error that stopped it. Results cut short by ctx are kept, marked
+// incomplete.
+func (b *Batch) SetResult(i int, res *Result, err error) {
+	repo := b.Repos[i]
+	repo.Result = res
+	if err != nil && (res == nil || !res.Incomplete) {
+		repo.Err = err
+	}
+	if repo.scanner == nil {
+		return
+	}
+	if r, _, _, err := repo.scanner.openRepo(); err == nil {
+		if commit, err := ResolveCommit(r, b.options.Rev); err == nil {
+			repo.Commit = commit.Hash.String()
+		}
+		repo.Branch = b.options.Rev
+		if head, err := r.Head(); err == nil && repo.Branch == "" {
+			repo.Branch = head.Name().Short()
+		}
+	}
+}
+
+// Combine rebuilds the aggregate result from the repositories scanned
+// so far, tallying the blame with the batch's date range and grouping.
+// The files of each repository, and of its submodules scanned in
+// recurse mode, are placed below a directory named after it. Mailmaps
+// of every repository are combined, so an identity mapped in one
+// applies to all of them.
+func (b *Batch) Combine() {
+	agg := newResult("")
+	agg.mailmap = NewMailmap()
+	for _, repo := range b.Repos {
+		if repo.Result == nil {
+			// Repositories not reached before the scan was cancelled
+			agg.Incomplete = agg.Incomplete || repo.Err == nil
+			continue
+		}
+		agg.combine(repo.Name, repo.Result)
+	}
+	agg.sortCounts()
+	agg.sortSkipped()
+	agg.sortErrors()
+	agg.sortBlameFailures()
+	agg.TallyBlame(b.options.DateRange, b.options.GroupBy)
+	b.Aggregate = agg
+}
+
+// combine adds the counts and blame tallies of res to the aggregate
+// result r, with paths below dir.
+func (r *Result) combine(dir string, res *Result) {
+	res.locker.Lock()
+	defer res.locker.Unlock()
+
+	rel := func(p string) string {
+		return path.Join(dir, relativeSlashPath(res.root, p))
+	}
+	for _, f := range res.Files {
+		r.record(rel(f.Path), f.Lines)
+	}
+	for t, n := range res.tallies {
+		t.dir = path.Join(dir, t.dir)
+		r.tallies[t] += n
+	}
+	r.mailmap.merge(res.mailmap)
+
+	for _, s := range res.Skipped {
+		r.Skipped = append(r.Skipped, SkippedEntry{Path: rel(s.Path), Reason: s.Reason})
+	}
+	for _, fe := range res.Errors {
+		fe.Path = rel(fe.Path)
+		r.Errors = append(r.Errors, fe)
+	}
+	for _, bf := range res.BlameFailures {
+		bf.Path = rel(bf.Path)
+		r.BlameFailures = append(r.BlameFailures, bf)
+	}
+	r.BlamedLines += res.BlamedLines
+	r.Incomplete = r.Incomplete || res.Incomplete
+
+	for _, sub := range res.Submodules {
+		r.combine(path.Join(dir, sub.Path), sub.Result)
+	}
+}
@@ -2,20 +2,28 @@
 count/Blame.go
 
 Functionality to blame the set of files processed by the directory walk.
-It spawns workers to process files in parallel and update global blame state
-with the number of lines attributed to each author
+It spawns workers to process files in parallel and record in the scan Result
+the number of lines attributed to each author, optionally restricted
+to lines last changed within a date range. Author identities are grouped
+by name, email or through the repository's mailmap, and changes made by
+ignored revisions are attributed to the previous author. Results are
+cached on disk per file, see count/BlameCache.go. Files are blamed by
+go-git or the git binary, see count/BlameBackend.go.
 */
 
 package count
 
 import (
+	"context"
+	"errors"
 	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // Holds blame data for a single author
@@ -33,57 +41,94 @@ type BlameJob struct {
 	index int
 }
 
+// Key for the number of lines of one kind attributed to one author
+// identity for one filetype in one directory by commits made at the
+// same time
+type blameTally struct {
+	name     string
+	email    string
+	filetype string
+	kind     lineKind
+	dir      string
+	when     int64
+}
 
-var (
-	// Global blame state
-	BlameCounts        = make(map[string]*BlameCount)
-	blameCountsLocker  sync.Mutex
-	// Channel for sending messages to the TUI
-	BlameStatusChannel = make(chan tea.Msg)
-)
+// Blame blames every file in res in parallel, recording the number of
+// lines attributed to each author, then tallies them with the scanner's
+// date range and grouping. Files that can't be blamed are recorded in
+// res.BlameFailures with the reason, and submodules scanned in recurse
+// mode are blamed against their own repositories. If ctx is done
+// first, workers stop after their current file, the files blamed so
+// far are tallied and res is marked incomplete.
+func (s *Scanner) Blame(ctx context.Context, res *Result) error {
+	numWorkers := s.options.jobs(runtime.NumCPU() / 2)
+	opts := s.options
 
-// BlameRepo iterates over all valid files found duing the file walk
-// and blames each file in parallel. It updates the BlameCounts map
-// with the number of lines attributed to each author.
-func BlameRepo(rootFs string) error {
-	numWorkers := runtime.NumCPU() / 2
-	if numWorkers < 1 {
-		numWorkers = 1
+	// Catch errors before creating workers, and load the mailmap
+	// up front so identities can be canonicalized when tallying
+	repo, repoRoot, prefix, err := s.openRepo()
+	if err != nil {
+		return err
+	}
+	commit, err := ResolveCommit(repo, opts.Rev)
+	if err != nil {
+		return err
+	}
+	mailmap, err := LoadMailmap(repoRoot, commit, opts.Mailmap)
+	if err != nil {
+		return err
+	}
+	ignoreRevs, err := LoadIgnoreRevs(repo, repoRoot, commit, opts.IgnoreRevs)
+	if err != nil {
+		return err
 	}
+	res.locker.Lock()
+	res.mailmap = mailmap
+	files := res.Files
+	res.locker.Unlock()
+
+	var cache *blameCache
+	if !opts.NoCache {
+		cache = openBlameCache(repo)
+	}
+
 	jobs := make(chan BlameJob)
 	var wg sync.WaitGroup
 	wg.Add(numWorkers)
-
-	totalFileCount := len(Files)
+	totalFileCount := len(files)
 
 	// start workers
 	for w := 0; w < numWorkers; w++ {
 		go func() {
 			defer wg.Done()
 
-			// Each worker opens its own repo/commit object
-			repo, err := git.PlainOpen(rootFs)
-			if err != nil {
-				return
+			// Each worker opens its own repo/commit object. If that
+			// fails, every file it receives is recorded as failed.
+			var commit *object.Commit
+			var backend BlameBackend
+			repo, _, _, setupErr := s.openRepo()
+			if setupErr == nil {
+				commit, setupErr = ResolveCommit(repo, opts.Rev)
 			}
-			headRef, err := repo.Head()
-			if err != nil {
-				return
-			}
-			commit, err := repo.CommitObject(headRef.Hash())
-			if err != nil {
-				return
+			if setupErr == nil {
+				backend, setupErr = newBlameBackend(opts.Backend, repo, commit, ignoreRevs)
 			}
 
 			// process until jobs channel is closed
 			for job := range jobs {
+				// Skip jobs received after cancellation
+				if ctx.Err() != nil {
+					continue
+				}
 				file := job.file
 				current := job.index
-				localizedPath, _ := strings.CutPrefix(file.Path, rootFs+"/")
+				// Blame by the path within the repository, which
+				// differs when scanning a subdirectory
+				localizedPath := repoPath(s.root, prefix, file.Path)
 
 				// non‑blocking status update
 				select {
-				case BlameStatusChannel <- BlameStatusMsg{
+				case s.status <- BlameStatusMsg{
 					Filepath:    localizedPath,
 					CurrentFile: current,
 					TotalFiles:  totalFileCount,
@@ -91,93 +136,259 @@ func BlameRepo(rootFs string) error {
 				default:
 				}
 
-				blame, err := git.Blame(commit, localizedPath)
+				if setupErr != nil {
+					res.blameFailed(file.Path, BlameFailedError, setupErr)
+					continue
+				}
+				blob, reason, err := blameTarget(commit, localizedPath)
 				if err != nil {
+					res.blameFailed(file.Path, reason, err)
 					continue
 				}
-
-				// Update the shared counts
-				blameCountsLocker.Lock()
-				for _, line := range blame.Lines {
-					bc, ok := BlameCounts[line.AuthorName]
-					if !ok {
-						bc = &BlameCount{
-							Author:      line.AuthorName,
-							LinesByType: make(map[string]*FileCount),
-						}
-						BlameCounts[line.AuthorName] = bc
+				hunks, err := blameHunks(ctx, backend, commit, localizedPath, ignoreRevs, cache)
+				if err != nil {
+					// Files interrupted by cancellation weren't failures
+					if ctx.Err() == nil {
+						res.blameFailed(file.Path, BlameFailedError, err)
 					}
-					if _, ok := bc.LinesByType[file.Filetype]; !ok {
-						bc.LinesByType[file.Filetype] = &FileCount{
-							Filetype: file.Filetype,
+					continue
+				}
+
+				s.reportLineRanges(file, localizedPath, hunks)
+
+				// Split hunks into code, comment and blank lines using the
+				// blamed contents. Unreadable files count as code.
+				kinds, _ := blamedLineKinds(blob, file.Filetype)
+				dir := fileDir(s.root, file.Path)
+
+				// Update the shared tallies
+				res.locker.Lock()
+				line := 0
+				for _, hunk := range hunks {
+					for kind, n := range countLineKinds(kinds, line, hunk.Lines) {
+						if n == 0 {
+							continue
 						}
+						res.tallies[blameTally{
+							name:     hunk.Name,
+							email:    hunk.Email,
+							filetype: file.Filetype,
+							kind:     lineKind(kind),
+							dir:      dir,
+							when:     hunk.When.Unix(),
+						}] += n
 					}
-					bc.Count++
-					bc.LinesByType[file.Filetype].Count++
+					line += hunk.Lines
 				}
-				blameCountsLocker.Unlock()
+				res.BlamedLines += line
+				res.locker.Unlock()
 			}
 		}()
 	}
 
-	// feed jobs from global valid files list
-	for i, f := range Files {
-		jobs <- BlameJob{file: f, index: i + 1}
+	// feed jobs from the result's valid files list until cancelled
+feed:
+	for i, f := range files {
+		select {
+		case jobs <- BlameJob{file: f, index: i + 1}:
+		case <-ctx.Done():
+			break feed
+		}
 	}
 	close(jobs)
 	wg.Wait()
-	return nil
+	if cache != nil {
+		cache.prune()
+	}
+
+	// Submodules are blamed against their own repositories
+	s.blameSubmodules(ctx, res)
+
+	res.locker.Lock()
+	res.sortBlameFailures()
+	res.locker.Unlock()
+
+	err = ctx.Err()
+	if err != nil {
+		res.locker.Lock()
+		res.Incomplete = true
+		res.locker.Unlock()
+	}
+	res.TallyBlame(opts.DateRange, opts.GroupBy)
+	return err
 }
 
-// Bubble tea compatible command to start the blame process
-func StartBlameRepo(rootFs string) tea.Cmd {
+// Bubble tea compatible command to start the blame process. A blame
+// that timed out is reported as done with its partial result.
+func (s *Scanner) StartBlame(ctx context.Context, res *Result) tea.Cmd {
 	return func() tea.Msg {
-		//Catch errors before creating workers
-		repo, err := git.PlainOpen(rootFs)
-		if err != nil {
-			return BlameErrorMsg{Err: err}
-		}
-		headRef, err := repo.Head()
-		if err != nil {
-			return BlameErrorMsg{Err: err}
-		}
-		_, err = repo.CommitObject(headRef.Hash())
-		if err != nil {
+		if err := s.Blame(ctx, res); err != nil && !errors.Is(err, context.DeadlineExceeded) {
 			return BlameErrorMsg{Err: err}
 		}
+		return res.blameDoneMsg()
+	}
+}
 
-		// Blame the repo
-		if err := BlameRepo(rootFs); err != nil {
-			return BlameErrorMsg{Err: err}
+// TallyBlame aggregates the recorded blame tallies into BlameCounts,
+// grouping authors by groupBy. Only lines last changed within dateRange
+// are attributed to their authors, the rest are collected into the
+// BlameOlder and BlameNewer buckets. The directory tree is rebuilt
+// with the attributed lines. Submodules are tallied again as well.
+func (r *Result) TallyBlame(dateRange DateRange, groupBy GroupBy) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	for _, sub := range r.Submodules {
+		sub.Result.TallyBlame(dateRange, groupBy)
+	}
+
+	counts := make(map[string]*BlameCount)
+	byDir := make(map[string]map[string]int)
+	var older, newer *BlameCount
+	if !dateRange.Since.IsZero() {
+		older = newBlameCount("Older")
+	}
+	if !dateRange.Until.IsZero() {
+		newer = newBlameCount("Newer")
+	}
+
+	for t, n := range r.tallies {
+		when := time.Unix(t.when, 0)
+		var bc *BlameCount
+		switch {
+		case dateRange.IsOlder(when):
+			bc = older
+		case dateRange.IsNewer(when):
+			bc = newer
+		default:
+			author := t.author(groupBy, r.mailmap)
+			var ok bool
+			bc, ok = counts[author]
+			if !ok {
+				bc = newBlameCount(author)
+				counts[author] = bc
+			}
+			if _, ok := byDir[t.dir]; !ok {
+				byDir[t.dir] = make(map[string]int)
+			}
+			byDir[t.dir][author] += n
 		}
+		bc.add(t.filetype, t.kind, n)
+	}
 
-		// Sort Contributors by count
-		keys := make([]string, 0, len(BlameCounts))
-		for k := range BlameCounts {
-			keys = append(keys, k)
+	// Sort Contributors by count
+	keys := make([]string, 0, len(counts))
+	for k, bc := range counts {
+		keys = append(keys, k)
+		bc.sortKeys()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return counts[keys[i]].Count > counts[keys[j]].Count
+	})
+	for _, bc := range []*BlameCount{older, newer} {
+		if bc != nil {
+			bc.sortKeys()
 		}
-		sort.Slice(keys, func(i, j int) bool {
-			return BlameCounts[keys[i]].Count > BlameCounts[keys[j]].Count
-		})
-
-		// Create alphabetical and count sorted key arrays
-		for _, k := range keys {
-			bc := BlameCounts[k]
-			var filetypeKeys []string
-			for k := range bc.LinesByType {
-				filetypeKeys = append(filetypeKeys, k)
-			}
-			sort.Strings(filetypeKeys)
-			bc.SortedAlphabeticalKeys = filetypeKeys
-
-			SortedCountsKeys := make([]string, len(filetypeKeys))
-			copy(SortedCountsKeys, filetypeKeys)
-			sort.Slice(SortedCountsKeys, func(i, j int) bool {
-				return bc.LinesByType[SortedCountsKeys[i]].Count > bc.LinesByType[SortedCountsKeys[j]].Count
-			})
-			bc.SortedCountsKeys = SortedCountsKeys
+	}
+
+	r.BlameCounts = counts
+	r.SortedBlameKeys = keys
+	r.BlameOlder = older
+	r.BlameNewer = newer
+	r.DateRange = dateRange
+	r.GroupBy = groupBy
+	r.Tree = r.dirTree(byDir)
+}
+
+func (r *Result) blameDoneMsg() BlameDoneMsg {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return BlameDoneMsg{
+		Counts:     r.BlameCounts,
+		SortedKeys: r.SortedBlameKeys,
+		Older:      r.BlameOlder,
+		Newer:      r.BlameNewer,
+		DateRange:  r.DateRange,
+		GroupBy:    r.GroupBy,
+		Tree:       r.Tree,
+		Failures:   r.BlameFailures,
+		Coverage:   r.blameCoverage(),
+		Submodules: r.Submodules,
+		Incomplete: r.Incomplete,
+	}
+}
+
+// Bubble tea compatible command to re-apply the date range and
+// author grouping to the blame results without blaming again
+func RetallyBlame(res *Result, dateRange DateRange, groupBy GroupBy) tea.Cmd {
+	return func() tea.Msg {
+		res.TallyBlame(dateRange, groupBy)
+		return res.blameDoneMsg()
+	}
+}
+
+// Bubble tea compatible command to show a result that was already
+// walked and blamed, sending the same messages as scanning it
+func ShowResult(res *Result) tea.Cmd {
+	return tea.Sequence(
+		func() tea.Msg { return res.walkDoneMsg() },
+		func() tea.Msg { return res.blameDoneMsg() },
+	)
+}
+
+// author returns the name the tally is grouped under.
+func (t blameTally) author(groupBy GroupBy, mailmap *Mailmap) string {
+	switch groupBy {
+	case GroupByName:
+		return t.name
+	case GroupByEmail:
+		return strings.ToLower(t.email)
+	}
+	name, _ := mailmap.Lookup(t.name, t.email)
+	return name
+}
+
+func newBlameCount(author string) *BlameCount {
+	return &BlameCount{
+		Author:      author,
+		LinesByType: make(map[string]*FileCount),
+	}
+}
+
+// add attributes n lines of filetype and kind to the author
+func (bc *BlameCount) add(filetype string, kind lineKind, n int) {
+	if _, ok := bc.LinesByType[filetype]; !ok {
+		bc.LinesByType[filetype] = &FileCount{
+			Filetype: filetype,
 		}
+	}
+	bc.Count += n
+	bc.LinesByType[filetype].add(kind, n)
+}
 
-		return BlameDoneMsg{Counts: BlameCounts, SortedKeys: keys}
+// blamedLineKinds classifies the lines of the blamed blob, the
+// contents the blame hunks describe.
+func blamedLineKinds(blob *object.File, filetype string) ([]lineKind, error) {
+	contents, err := blob.Contents()
+	if err != nil {
+		return nil, err
 	}
+	return classifyLines(filetype, []byte(contents)), nil
+}
+
+// Create alphabetical and count sorted key arrays
+func (bc *BlameCount) sortKeys() {
+	var filetypeKeys []string
+	for k := range bc.LinesByType {
+		filetypeKeys = append(filetypeKeys, k)
+	}
+	sort.Strings(filetypeKeys)
+	bc.SortedAlphabeticalKeys = filetypeKeys
+
+	SortedCountsKeys := make([]string, len(filetypeKeys))
+	copy(SortedCountsKeys, filetypeKeys)
+	sort.Slice(SortedCountsKeys, func(i, j int) bool {
+		return bc.LinesByType[SortedCountsKeys[i]].Count > bc.LinesByType[SortedCountsKeys[j]].Count
+	})
+	bc.SortedCountsKeys = SortedCountsKeys
 }
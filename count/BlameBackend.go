@@ -0,0 +1,311 @@
+/*
+count/BlameBackend.go
+
+Attribution backends used by BlameRepo. The go-git backend blames files
+in process, while the git backend shells out to the native git binary
+and parses the output of git blame --porcelain, which is much faster on
+long histories. Both produce the same run-length encoded hunks.
+*/
+
+package count
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Which attribution backend to blame files with
+type BackendKind string
+
+const (
+	// Use the git binary if it is on PATH, otherwise go-git
+	BackendAuto BackendKind = "auto"
+	// Blame in process with go-git
+	BackendGoGit BackendKind = "gogit"
+	// Shell out to git blame --porcelain
+	BackendGit BackendKind = "git"
+)
+
+// ParseBackendKind validates a --blame-backend value.
+func ParseBackendKind(s string) (BackendKind, error) {
+	switch k := BackendKind(s); k {
+	case BackendAuto, BackendGoGit, BackendGit:
+		return k, nil
+	}
+	return "", fmt.Errorf("invalid blame backend %q, expected auto, gogit or git", s)
+}
+
+// Resolve returns the concrete backend to use, picking git for auto
+// when the binary is available.
+func (k BackendKind) Resolve() BackendKind {
+	if k == BackendAuto || k == "" {
+		if _, err := exec.LookPath("git"); err == nil {
+			return BackendGit
+		}
+		return BackendGoGit
+	}
+	return k
+}
+
+// Attributes every line of a file to the commit that last changed it.
+// Backends are not safe for concurrent use, each worker creates its own.
+type BlameBackend interface {
+	// Name identifies the backend in cache keys
+	Name() string
+	// Blame returns the hunks of path at the backend's commit,
+	// giving up early if ctx is done
+	Blame(ctx context.Context, path string) ([]BlameHunk, error)
+}
+
+// newBlameBackend creates a backend of kind blaming files at commit.
+func newBlameBackend(kind BackendKind, repo *git.Repository, commit *object.Commit, ignore IgnoreRevs) (BlameBackend, error) {
+	// Repositories that aren't on disk, such as in-memory clones, can
+	// only be blamed in process unless git was asked for explicitly
+	if kind != BackendGit && repoGitDir(repo) == "" {
+		kind = BackendGoGit
+	}
+	switch kind.Resolve() {
+	case BackendGit:
+		gitDir := repoGitDir(repo)
+		if gitDir == "" {
+			return nil, fmt.Errorf("git blame backend requires a repository on disk")
+		}
+		return &gitBackend{gitDir: gitDir, commit: commit.Hash, ignore: ignore}, nil
+	case BackendGoGit:
+		return &goGitBackend{
+			repo:    repo,
+			commit:  commit,
+			ignore:  ignore,
+			commits: make(map[plumbing.Hash]*object.Commit),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown blame backend %q", kind)
+}
+
+// -- go-git backend --
+
+type goGitBackend struct {
+	repo    *git.Repository
+	commit  *object.Commit
+	ignore  IgnoreRevs
+	commits map[plumbing.Hash]*object.Commit
+}
+
+func (b *goGitBackend) Name() string {
+	return string(BackendGoGit)
+}
+
+func (b *goGitBackend) Blame(ctx context.Context, path string) ([]BlameHunk, error) {
+	// go-git can't be interrupted part way through a file
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	lines, err := blameFile(b.repo, b.commit, path, b.ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	var hunks []BlameHunk
+	for _, line := range lines {
+		if n := len(hunks); n > 0 && hunks[n-1].Hash == line.Hash.String() {
+			hunks[n-1].Lines++
+			continue
+		}
+
+		// git.Line only carries the author, so look up the committer
+		commit, ok := b.commits[line.Hash]
+		if !ok {
+			commit, err = b.repo.CommitObject(line.Hash)
+			if err != nil {
+				return nil, err
+			}
+			b.commits[line.Hash] = commit
+		}
+
+		hunks = append(hunks, BlameHunk{
+			Hash:           line.Hash.String(),
+			Name:           line.AuthorName,
+			Email:          line.Author,
+			When:           line.Date,
+			CommitterName:  commit.Committer.Name,
+			CommitterEmail: commit.Committer.Email,
+			CommitterWhen:  commit.Committer.When,
+			Boundary:       commit.NumParents() == 0,
+			Lines:          1,
+		})
+	}
+	return hunks, nil
+}
+
+// -- git binary backend --
+
+type gitBackend struct {
+	gitDir string
+	commit plumbing.Hash
+	ignore IgnoreRevs
+}
+
+func (b *gitBackend) Name() string {
+	return string(BackendGit)
+}
+
+func (b *gitBackend) Blame(ctx context.Context, path string) ([]BlameHunk, error) {
+	args := []string{
+		"--git-dir=" + b.gitDir,
+		// Identities are canonicalized by our own mailmap handling, and
+		// ignored revisions are passed explicitly below
+		"-c", "mailmap.file=",
+		"-c", "mailmap.blob=",
+		"-c", "blame.ignoreRevsFile=",
+		"blame", "--porcelain",
+	}
+	ignored := make([]string, 0, len(b.ignore))
+	for hash := range b.ignore {
+		ignored = append(ignored, hash.String())
+	}
+	sort.Strings(ignored)
+	for _, hash := range ignored {
+		args = append(args, "--ignore-rev", hash)
+	}
+	args = append(args, b.commit.String(), "--", path)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// Run from inside the git directory so no working tree .mailmap is read
+	cmd.Dir = b.gitDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("git blame %s: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return parsePorcelain(out)
+}
+
+// parsePorcelain parses the output of git blame --porcelain into hunks
+// ordered by final line number.
+func parsePorcelain(out []byte) ([]BlameHunk, error) {
+	commits := make(map[string]*BlameHunk)
+	lineHashes := make(map[int]string)
+	maxLine := 0
+
+	var current *BlameHunk
+	expectHeader := true
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Content lines end each entry, the next line is a header
+		if strings.HasPrefix(line, "\t") {
+			expectHeader = true
+			continue
+		}
+
+		// Entry header: <hash> <orig line> <final line> [<lines in group>]
+		if expectHeader {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) != 40 {
+				return nil, fmt.Errorf("invalid porcelain header %q", line)
+			}
+			final, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid porcelain header %q", line)
+			}
+			hash := fields[0]
+			current = commits[hash]
+			if current == nil {
+				current = &BlameHunk{Hash: hash}
+				commits[hash] = current
+			}
+			lineHashes[final] = hash
+			if final > maxLine {
+				maxLine = final
+			}
+			expectHeader = false
+			continue
+		}
+
+		// Commit metadata, only sent the first time a commit appears
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.Name = value
+		case "author-mail":
+			current.Email = trimMail(value)
+		case "author-time":
+			current.When = parseUnixTime(value)
+		case "author-tz":
+			current.When = inZone(current.When, value)
+		case "committer":
+			current.CommitterName = value
+		case "committer-mail":
+			current.CommitterEmail = trimMail(value)
+		case "committer-time":
+			current.CommitterWhen = parseUnixTime(value)
+		case "committer-tz":
+			current.CommitterWhen = inZone(current.CommitterWhen, value)
+		case "boundary":
+			current.Boundary = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Run-length encode lines in final order
+	var hunks []BlameHunk
+	for l := 1; l <= maxLine; l++ {
+		hash, ok := lineHashes[l]
+		if !ok {
+			return nil, fmt.Errorf("porcelain output is missing line %d", l)
+		}
+		if n := len(hunks); n > 0 && hunks[n-1].Hash == hash {
+			hunks[n-1].Lines++
+			continue
+		}
+		hunk := *commits[hash]
+		hunk.Lines = 1
+		hunks = append(hunks, hunk)
+	}
+	return hunks, nil
+}
+
+func trimMail(value string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+}
+
+func parseUnixTime(value string) time.Time {
+	secs, _ := strconv.ParseInt(value, 10, 64)
+	return time.Unix(secs, 0)
+}
+
+// inZone converts t to the +hhmm or -hhmm zone reported by git.
+func inZone(t time.Time, tz string) time.Time {
+	if len(tz) != 5 {
+		return t
+	}
+	hours, err1 := strconv.Atoi(tz[1:3])
+	minutes, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return t
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return t.In(time.FixedZone("", offset))
+}
@@ -0,0 +1,238 @@
+package count
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitCommit commits every change in dir as author, at the given number
+// of days after the epoch of the fixture, and returns the commit hash.
+func gitCommit(t testing.TB, dir, author string, day int) string {
+	t.Helper()
+	date := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, day).Format(time.RFC3339)
+	email := strings.ToLower(author) + "@example.com"
+	env := []string{
+		"GIT_AUTHOR_NAME=" + author, "GIT_AUTHOR_EMAIL=" + email, "GIT_AUTHOR_DATE=" + date,
+		"GIT_COMMITTER_NAME=" + author, "GIT_COMMITTER_EMAIL=" + email, "GIT_COMMITTER_DATE=" + date,
+	}
+	runGit(t, dir, nil, "add", "-A")
+	runGit(t, dir, env, "commit", "-q", "-m", "change by "+author)
+	return strings.TrimSpace(runGit(t, dir, nil, "rev-parse", "HEAD"))
+}
+
+// runGit runs git in dir with the extra environment, returning its
+// output.
+func runGit(t testing.TB, dir string, env []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(cmd.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// newBlameFixture creates a repository with lines by several authors,
+// and returns it along with the hash of a commit that only reformats
+// lines of others. The reformat changes lines in place, splits and
+// joins lines and inserts blank ones, so it changes the line count.
+func newBlameFixture(t *testing.T) (repo, reformat string) {
+	t.Helper()
+	requireGit(t)
+	dir := t.TempDir()
+	t.Setenv("HOME", filepath.Join(dir, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "home", ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	repo = filepath.Join(dir, "repo")
+	runGit(t, dir, nil, "init", "-q", "repo")
+
+	write := func(name, content string) {
+		writeFixtureFile(t, filepath.Join(repo, filepath.FromSlash(name)), content)
+	}
+	write("main.go", "package main\n\nfunc main() {\n\tprintln(1)\n}\n")
+	write("docs/my notes.txt", "one\ntwo\nthree\n")
+	gitCommit(t, repo, "Alice", 0)
+
+	write("main.go", "package main\n\nfunc main() {\n\tprintln(1)\n\tprintln(2)\n}\n\n// values\nvar values = []int{\n\t1,\n\t2,\n}\n// helper\nfunc helper() { println(3) }\n// end\n")
+	write("docs/my notes.txt", "one\n2\nthree\nfour\n")
+	gitCommit(t, repo, "Bob", 1)
+
+	write("main.go", "package main\n\nfunc main() {\n    println(1)\n\tprintln(\n\t\t2)\n}\n\n// values\nvar values = []int{1, 2}\n// helper\n\nfunc helper() {\n\tprintln(3) }\n// end\n")
+	reformat = gitCommit(t, repo, "Carol", 2)
+
+	write("util.go", "package main\n\nvar x = 1\n")
+	gitCommit(t, repo, "Alice", 3)
+	return repo, reformat
+}
+
+// blameLines returns the number of lines blamed to each author.
+func blameLines(t *testing.T, repo string, opts Options) map[string]int {
+	t.Helper()
+	opts.NoCache = true
+	res, err := NewScanner(repo, IgnoreConfig{}, opts).Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.BlameFailures) > 0 {
+		t.Fatalf("blame failures: %+v", res.BlameFailures)
+	}
+	lines := make(map[string]int)
+	for author, c := range res.BlameCounts {
+		lines[author] = c.Count
+	}
+	return lines
+}
+
+// TestBackendsAgree checks that the go-git and git backends attribute
+// the fixture's lines the same way, with and without ignored revisions.
+func TestBackendsAgree(t *testing.T) {
+	repo, reformat := newBlameFixture(t)
+	// Lines blamed to the reformat, with and without ignoring it. The
+	// inserted blank line matches no line it replaced, so it stays.
+	reformatLines := map[bool]int{false: 7, true: 1}
+	tests := []struct {
+		name       string
+		ignoreRevs []string
+	}{
+		{"all revisions", nil},
+		{"ignore reformat", []string{reformat}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gogit := blameLines(t, repo, Options{Backend: BackendGoGit, IgnoreRevs: tt.ignoreRevs})
+			gitBin := blameLines(t, repo, Options{Backend: BackendGit, IgnoreRevs: tt.ignoreRevs})
+			if !reflect.DeepEqual(gogit, gitBin) {
+				t.Errorf("gogit blamed %v, git blamed %v", gogit, gitBin)
+			}
+			if len(gogit) == 0 {
+				t.Error("no lines were blamed")
+			}
+			carol := 0
+			for author, n := range gogit {
+				if strings.Contains(author, "Carol") {
+					carol += n
+				}
+			}
+			if want := reformatLines[tt.ignoreRevs != nil]; carol != want {
+				t.Errorf("%d lines blamed to the reformat commit, want %d", carol, want)
+			}
+		})
+	}
+}
+
+const (
+	porcelainAlice = "1111111111111111111111111111111111111111"
+	porcelainBob   = "2222222222222222222222222222222222222222"
+)
+
+func TestParsePorcelain(t *testing.T) {
+	// Bob's header comes first, Alice's second entry and Bob's second
+	// entry repeat the commit without its metadata. Alice's commit is a
+	// boundary, and the file name has spaces.
+	out := porcelainBob + " 2 1 1\n" +
+		"author Bob\n" +
+		"author-mail <bob@example.com>\n" +
+		"author-time 1704196800\n" +
+		"author-tz +0100\n" +
+		"committer Bob\n" +
+		"committer-mail <bob@example.com>\n" +
+		"committer-time 1704200400\n" +
+		"committer-tz -0230\n" +
+		"summary change by Bob\n" +
+		"filename docs/my notes.txt\n" +
+		"\t2\n" +
+		porcelainAlice + " 1 2 2\n" +
+		"author Alice\n" +
+		"author-mail <alice@example.com>\n" +
+		"author-time 1704110400\n" +
+		"author-tz +0000\n" +
+		"committer Alice\n" +
+		"committer-mail <alice@example.com>\n" +
+		"committer-time 1704110400\n" +
+		"committer-tz +0000\n" +
+		"summary change by Alice\n" +
+		"boundary\n" +
+		"filename docs/my notes.txt\n" +
+		"\tone\n" +
+		porcelainAlice + " 3 3\n" +
+		"filename docs/my notes.txt\n" +
+		"\tthree\n" +
+		porcelainBob + " 4 4 1\n" +
+		"filename docs/my notes.txt\n" +
+		"\tfour\n"
+
+	hunks, err := parsePorcelain([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := BlameHunk{
+		Hash:           porcelainBob,
+		Name:           "Bob",
+		Email:          "bob@example.com",
+		When:           time.Unix(1704196800, 0).In(time.FixedZone("", 3600)),
+		CommitterName:  "Bob",
+		CommitterEmail: "bob@example.com",
+		CommitterWhen:  time.Unix(1704200400, 0).In(time.FixedZone("", -9000)),
+	}
+	alice := BlameHunk{
+		Hash:           porcelainAlice,
+		Name:           "Alice",
+		Email:          "alice@example.com",
+		When:           time.Unix(1704110400, 0).In(time.FixedZone("", 0)),
+		CommitterName:  "Alice",
+		CommitterEmail: "alice@example.com",
+		CommitterWhen:  time.Unix(1704110400, 0).In(time.FixedZone("", 0)),
+		Boundary:       true,
+	}
+	hunk := func(h BlameHunk, lines int) BlameHunk {
+		h.Lines = lines
+		return h
+	}
+	want := []BlameHunk{hunk(bob, 1), hunk(alice, 2), hunk(bob, 1)}
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("parsePorcelain =\n%+v\nwant\n%+v", hunks, want)
+	}
+}
+
+func TestParsePorcelainErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+	}{
+		{"short hash", "1234 1 1 1\n\tline\n"},
+		{"missing final line", porcelainAlice + " 1\n\tline\n"},
+		{"invalid final line", porcelainAlice + " 1 x 1\n\tline\n"},
+		{"missing line", porcelainAlice + " 1 2 1\nauthor Alice\n\tline\n"},
+	}
+	for _, tt := range tests {
+		if _, err := parsePorcelain([]byte(tt.out)); err == nil {
+			t.Errorf("%s: parsePorcelain succeeded", tt.name)
+		}
+	}
+}
+
+// TestParsePorcelainGit parses the output of git itself for a file
+// with spaces in its name.
+func TestParsePorcelainGit(t *testing.T) {
+	repo, _ := newBlameFixture(t)
+	out := runGit(t, repo, nil, "blame", "--porcelain", "HEAD", "--", "docs/my notes.txt")
+	hunks, err := parsePorcelain([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range hunks {
+		got = append(got, h.Name+" "+strings.Repeat("+", h.Lines))
+	}
+	want := []string{"Alice +", "Bob +", "Alice +", "Bob +"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blamed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,271 @@
+/*
+count/BlameCache.go
+
+Persistent on-disk cache of per-file blame results, stored under
+.git/whodunnit/blame. Entries are keyed by the file's path, the hash
+of its blob, the last commit that changed it and the set of ignored
+revisions. New commits only cause the files they touch to be blamed
+again, while rewritten history changes the last commit of the files
+below it, so stale attributions are never returned. Entries that
+haven't been used for a while are pruned. Writes go through a
+temporary file and a rename, so concurrent workers and processes never
+observe partial entries.
+*/
+
+package count
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Bump when the format of cached entries changes
+const blameCacheVersion = "v4"
+
+// Entries not read or written for this long are removed by prune,
+// which runs at most once per pruneInterval
+const (
+	blameCacheMaxAge = 14 * 24 * time.Hour
+	pruneInterval    = 24 * time.Hour
+)
+
+// A run of consecutive lines last changed by the same commit
+type BlameHunk struct {
+	Hash  string
+	Name  string
+	Email string
+	When  time.Time
+
+	CommitterName  string
+	CommitterEmail string
+	CommitterWhen  time.Time
+	// The commit has no parents, so lines were not traced further back
+	Boundary bool
+
+	Lines int
+}
+
+// Cached blame result for a single file
+type blameCacheEntry struct {
+	// Last commit that changed the file
+	Commit string
+	Path   string
+	Hunks  []BlameHunk
+}
+
+type blameCache struct {
+	dir string
+}
+
+// blameCacheDir returns the cache directory inside the repository's
+// common git directory, shared by its linked worktrees, or "" if the
+// repository isn't stored on disk.
+func blameCacheDir(repo *git.Repository) string {
+	gitDir := repoCommonDir(repo)
+	if gitDir == "" {
+		return ""
+	}
+	return filepath.Join(gitDir, "whodunnit", "blame")
+}
+
+// openBlameCache returns the cache for repo, or nil if it can't be used.
+func openBlameCache(repo *git.Repository) *blameCache {
+	dir := blameCacheDir(repo)
+	if dir == "" {
+		return nil
+	}
+	return &blameCache{dir: dir}
+}
+
+// key identifies the blame of a blob at path by a backend under a set
+// of ignored revisions. changed is the last commit that changed the
+// path, which differs once the history leading to it is rewritten.
+func (c *blameCache) key(backend string, changed plumbing.Hash, path string, blob plumbing.Hash, ignore IgnoreRevs) string {
+	ignored := make([]string, 0, len(ignore))
+	for hash := range ignore {
+		ignored = append(ignored, hash.String())
+	}
+	sort.Strings(ignored)
+
+	h := sha1.New()
+	h.Write([]byte(blameCacheVersion + "\x00" + backend + "\x00" + changed.String() + "\x00" + path + "\x00" + blob.String()))
+	for _, hash := range ignored {
+		h.Write([]byte("\x00" + hash))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *blameCache) entryPath(key string) string {
+	return filepath.Join(c.dir, key[:2], key[2:]+".json")
+}
+
+// get returns the cached hunks for key. Unreadable or corrupt
+// entries are treated as misses. Hits are marked as used, so they
+// aren't pruned.
+func (c *blameCache) get(key string) ([]BlameHunk, bool) {
+	path := c.entryPath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry blameCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return entry.Hunks, true
+}
+
+// prune removes the entries, and leftover temporary files, that
+// haven't been used within blameCacheMaxAge. It only walks the cache
+// if it wasn't pruned within pruneInterval, so most runs return
+// straight away. Entries that can't be removed are left for next time.
+func (c *blameCache) prune() {
+	stamp := filepath.Join(c.dir, ".pruned")
+	if info, err := os.Stat(stamp); err == nil && time.Since(info.ModTime()) < pruneInterval {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return
+	}
+	if err := os.WriteFile(stamp, nil, 0o644); err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-blameCacheMaxAge)
+	_ = filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path == stamp {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// put stores entry under key, atomically replacing any existing entry.
+func (c *blameCache) put(key string, entry blameCacheEntry) error {
+	path := c.entryPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// ClearBlameCache removes all cached blame results for the repository
+// containing root.
+func ClearBlameCache(root string) error {
+	repo, _, _, err := OpenRepo(root)
+	if err != nil {
+		return err
+	}
+	dir := blameCacheDir(repo)
+	if dir == "" {
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// blobAt returns the hash of the blob at path in commit.
+func blobAt(commit *object.Commit, path string) (plumbing.Hash, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return entry.Hash, nil
+}
+
+// lastChange returns the most recent commit reachable from commit that
+// changed the blob at path. Like git log, it follows a parent with the
+// same blob through merges. The search stops at commits whose parents
+// can't be read, such as the boundary of a shallow clone.
+func lastChange(commit *object.Commit, path string, blob plumbing.Hash) *object.Commit {
+	for {
+		var same *object.Commit
+		err := commit.Parents().ForEach(func(parent *object.Commit) error {
+			if hash, err := blobAt(parent, path); err == nil && hash == blob {
+				same = parent
+				return storer.ErrStop
+			}
+			return nil
+		})
+		if err != nil || same == nil {
+			return commit
+		}
+		commit = same
+	}
+}
+
+// blameHunks returns the blame of path at commit from backend, served
+// from the cache when the same blob was blamed before with the same
+// last change. cache may be nil.
+func blameHunks(ctx context.Context, backend BlameBackend, commit *object.Commit, path string, ignore IgnoreRevs, cache *blameCache) ([]BlameHunk, error) {
+	var key string
+	var changed *object.Commit
+	if cache != nil {
+		blob, err := blobAt(commit, path)
+		if err != nil {
+			return nil, err
+		}
+		changed = lastChange(commit, path, blob)
+		key = cache.key(backend.Name(), changed.Hash, path, blob, ignore)
+		if hunks, ok := cache.get(key); ok {
+			return hunks, nil
+		}
+	}
+
+	hunks, err := backend.Blame(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		// A failed write only means blaming the file again next run
+		_ = cache.put(key, blameCacheEntry{
+			Commit: changed.Hash.String(),
+			Path:   path,
+			Hunks:  hunks,
+		})
+	}
+	return hunks, nil
+}
@@ -0,0 +1,95 @@
+package count
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cacheEntries returns the number of entries in the blame cache of repo.
+func cacheEntries(t *testing.T, repo string) int {
+	t.Helper()
+	n := 0
+	dir := filepath.Join(repo, ".git", "whodunnit", "blame")
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".json") {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// cachedBlameLines returns the number of lines blamed to each author,
+// using the blame cache.
+func cachedBlameLines(t *testing.T, repo string) map[string]int {
+	t.Helper()
+	res, err := NewScanner(repo, IgnoreConfig{}, Options{Backend: BackendGoGit}).Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(map[string]int)
+	for author, c := range res.BlameCounts {
+		lines[author] = c.Count
+	}
+	return lines
+}
+
+// TestBlameCacheUnrelatedCommit checks that a commit only causes the
+// files it touches to be blamed again.
+func TestBlameCacheUnrelatedCommit(t *testing.T) {
+	repo, _ := newBlameFixture(t)
+	cachedBlameLines(t, repo)
+	before := cacheEntries(t, repo)
+	if before != 3 {
+		t.Fatalf("%d cache entries after the first scan, want 3", before)
+	}
+
+	// Rescanning the same commit is served from the cache
+	cachedBlameLines(t, repo)
+	if n := cacheEntries(t, repo); n != before {
+		t.Errorf("%d cache entries after rescanning, want %d", n, before)
+	}
+
+	// A commit adding a file only adds its entry
+	writeFixtureFile(t, filepath.Join(repo, "new.txt"), "new\n")
+	gitCommit(t, repo, "Bob", 4)
+	got := cachedBlameLines(t, repo)
+	if n := cacheEntries(t, repo); n != before+1 {
+		t.Errorf("%d cache entries after an unrelated commit, want %d", n, before+1)
+	}
+	if want := blameLines(t, repo, Options{Backend: BackendGoGit}); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached blame %v, want %v", got, want)
+	}
+}
+
+// TestBlameCacheRewrittenHistory checks that files below a rewritten
+// commit aren't served from the cache.
+func TestBlameCacheRewrittenHistory(t *testing.T) {
+	repo, _ := newBlameFixture(t)
+	cachedBlameLines(t, repo)
+
+	runGit(t, repo, []string{"GIT_AUTHOR_NAME=Dave", "GIT_AUTHOR_EMAIL=dave@example.com", "GIT_COMMITTER_NAME=Dave", "GIT_COMMITTER_EMAIL=dave@example.com"},
+		"commit", "-q", "--amend", "--reset-author", "--no-edit")
+	got := cachedBlameLines(t, repo)
+	want := blameLines(t, repo, Options{Backend: BackendGoGit})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cached blame %v, want %v", got, want)
+	}
+	dave := false
+	for author := range got {
+		dave = dave || strings.Contains(author, "Dave")
+	}
+	if !dave {
+		t.Errorf("rewritten commit isn't blamed: %v", got)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+count/BlameFailure.go
+
+Files that were counted but could not be blamed, recorded with the
+reason so they don't silently vanish from the blame counts. A file is
+untracked if it isn't in the blamed commit, inside a submodule if one
+of its parent directories is a gitlink, and binary if its blob in
+history is binary even though the counted file isn't. Anything else
+is recorded as an error. Coverage relates the blamed lines to the
+counted lines.
+*/
+
+package count
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Why a counted file wasn't blamed
+type BlameFailureReason string
+
+const (
+	BlameFailedUntracked BlameFailureReason = "untracked"
+	BlameFailedBinary    BlameFailureReason = "binary in history"
+	BlameFailedSubmodule BlameFailureReason = "submodule"
+	BlameFailedError     BlameFailureReason = "error"
+)
+
+type BlameFailure struct {
+	Path   string
+	Reason BlameFailureReason
+	// The underlying error's message
+	Message string
+}
+
+// blameTarget returns the blob of the file at path in commit, or why
+// it can't be blamed.
+func blameTarget(commit *object.Commit, path string) (*object.File, BlameFailureReason, error) {
+	blob, err := commit.File(path)
+	if err != nil {
+		if !errors.Is(err, object.ErrFileNotFound) {
+			return nil, BlameFailedError, err
+		}
+		if inSubmodule(commit, path) {
+			return nil, BlameFailedSubmodule, errors.New("file is inside a submodule")
+		}
+		return nil, BlameFailedUntracked, fmt.Errorf("file is not tracked in commit %s", commit.Hash)
+	}
+
+	binary, err := blob.IsBinary()
+	if err != nil {
+		return nil, BlameFailedError, err
+	}
+	if binary {
+		return nil, BlameFailedBinary, errors.New("file is binary in the blamed commit")
+	}
+	return blob, "", nil
+}
+
+// inSubmodule reports whether one of the parent directories of the
+// slash separated path is a submodule in commit.
+func inSubmodule(commit *object.Commit, path string) bool {
+	tree, err := commit.Tree()
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		entry, err := tree.FindEntry(strings.Join(parts[:i], "/"))
+		if err != nil {
+			return false
+		}
+		if entry.Mode == filemode.Submodule {
+			return true
+		}
+	}
+	return false
+}
+
+// blameFailed records a counted file that couldn't be blamed.
+func (r *Result) blameFailed(path string, reason BlameFailureReason, err error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.BlameFailures = append(r.BlameFailures, BlameFailure{
+		Path:    path,
+		Reason:  reason,
+		Message: err.Error(),
+	})
+}
+
+// sortBlameFailures orders the failures by path, as workers record
+// them in whatever order they finish.
+func (r *Result) sortBlameFailures() {
+	sort.Slice(r.BlameFailures, func(i, j int) bool {
+		return r.BlameFailures[i].Path < r.BlameFailures[j].Path
+	})
+}
+
+// BlameCoverage returns the share of counted lines that were blamed,
+// between 0 and 1. Blamed lines are counted in the blamed commit, so
+// uncommitted changes can push it slightly above 1.
+func (r *Result) BlameCoverage() float64 {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.blameCoverage()
+}
+
+func (r *Result) blameCoverage() float64 {
+	if r.TotalLines == 0 {
+		return 0
+	}
+	return float64(r.BlamedLines) / float64(r.TotalLines)
+}
@@ -0,0 +1,153 @@
+/*
+count/Clone.go
+
+Scanning a repository by URL without a checkout. The repository is
+cloned into go-git's in-memory storage and scanned like a bare
+repository, reading files from the tree of HEAD or the given revision,
+so nothing is written to disk. The on-disk blame cache is not used and
+files are always blamed in process unless the git backend is asked for.
+*/
+
+package count
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// Options for cloning a repository into memory
+type CloneOptions struct {
+	// Branch or tag to clone, the remote's HEAD if unset
+	Branch string
+	// Number of commits of history to fetch, zero for all of it.
+	// Lines last changed before the oldest fetched commit are
+	// attributed to it
+	Depth int
+}
+
+// Matches scp-like URLs such as git@github.com:owner/repo.git
+var scpURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9._-]+:`)
+
+// IsRepoURL reports whether target names a remote repository to clone,
+// rather than a directory on disk.
+func IsRepoURL(target string) bool {
+	return strings.Contains(target, "://") || scpURL.MatchString(target)
+}
+
+// RepoName returns the name of the repository at url, the last element
+// of its path without the .git suffix.
+func RepoName(url string) string {
+	url = strings.TrimRight(url, "/")
+	if i := strings.LastIndexAny(url, "/:"); i != -1 {
+		url = url[i+1:]
+	}
+	name := strings.TrimSuffix(path.Base(url), ".git")
+	if name == "" || name == "." {
+		return "repo"
+	}
+	return name
+}
+
+// CloneRepo clones the repository at url, which may also be a local
+// path, into memory without checking out a work tree.
+func CloneRepo(ctx context.Context, url string, opts CloneOptions) (*git.Repository, error) {
+	cloneOpts := &git.CloneOptions{
+		URL:   url,
+		Depth: opts.Depth,
+	}
+	if opts.Branch == "" {
+		return cloneShallow(ctx, cloneOpts)
+	}
+
+	// Short names are tried as a branch first, then as a tag
+	cloneOpts.SingleBranch = true
+	refs := []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(opts.Branch),
+		plumbing.NewTagReferenceName(opts.Branch),
+	}
+	if strings.HasPrefix(opts.Branch, "refs/") {
+		refs = []plumbing.ReferenceName{plumbing.ReferenceName(opts.Branch)}
+	}
+	var repo *git.Repository
+	var err error
+	for _, ref := range refs {
+		cloneOpts.ReferenceName = ref
+		repo, err = cloneShallow(ctx, cloneOpts)
+		if !errors.Is(err, git.NoMatchingRefSpecError{}) {
+			return repo, err
+		}
+	}
+	if len(refs) > 1 {
+		return nil, fmt.Errorf("no branch or tag named %q", opts.Branch)
+	}
+	return nil, err
+}
+
+// cloneShallow clones into memory. The history of a clone limited by
+// depth ends at commits whose parents weren't fetched, which are
+// reopened as root commits so that blaming stops at them.
+func cloneShallow(ctx context.Context, opts *git.CloneOptions) (*git.Repository, error) {
+	st := memory.NewStorage()
+	repo, err := git.CloneContext(ctx, st, nil, opts)
+	if err != nil || opts.Depth == 0 {
+		return repo, err
+	}
+	shallow, err := st.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	boundary := make(map[plumbing.Hash]bool, len(shallow))
+	for _, h := range shallow {
+		boundary[h] = true
+	}
+	return git.Open(&shallowStorage{Storage: st, boundary: boundary}, nil)
+}
+
+// Storage of a shallow clone, hiding the parents of its boundary commits
+type shallowStorage struct {
+	*memory.Storage
+	boundary map[plumbing.Hash]bool
+}
+
+func (s *shallowStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.Storage.EncodedObject(t, h)
+	if err != nil || !s.boundary[h] || obj.Type() != plumbing.CommitObject {
+		return obj, err
+	}
+	commit, err := object.DecodeCommit(s.Storage, obj)
+	if err != nil {
+		return nil, err
+	}
+	commit.ParentHashes = nil
+	root := &boundaryObject{hash: h}
+	if err := commit.Encode(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// A rewritten boundary commit, keeping the hash of the original
+type boundaryObject struct {
+	plumbing.MemoryObject
+	hash plumbing.Hash
+}
+
+func (o *boundaryObject) Hash() plumbing.Hash { return o.hash }
+
+// NewRepoScanner creates a scanner for a repository that isn't on disk,
+// such as one cloned by CloneRepo. Files are read from the tree of HEAD
+// or opts.Rev and are named as if they were below root.
+func NewRepoScanner(repo *git.Repository, root string, ignore IgnoreConfig, opts Options) *Scanner {
+	s := NewScanner(root, ignore, opts)
+	s.repo = repo
+	return s
+}
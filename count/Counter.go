@@ -1,98 +1,112 @@
 /*
 count/Counter.go
 
-Contains the global state and functions for counting lines in files.
+Contains the functions for counting lines in files and recording
+them in a scan Result. Lines are split into code, comment and blank
+lines, see count/LineKinds.go.
 */
 
 package count
 
 import (
-	"bytes"
-	"io"
-	"log"
-	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/go-enry/go-enry/v2"
 )
 
+// Filetype of files that have no extension and whose language couldn't
+// be detected
+const UnknownFiletype = "Unknown"
+
 type FileCount struct {
 	Filetype string
 	Count    int
+	// Count split into code, comment and blank lines
+	Code    int
+	Comment int
+	Blank   int
 }
 
 type ValidFile struct {
 	Filetype string
 	Path     string
+	Lines    FileCount
 }
 
-// Global result variables
-var Counts map[string]FileCount = make(map[string]FileCount)
-var Files []ValidFile = make([]ValidFile, 0)
-var TotalLines int
-
-
 // CountLines counts and returns the number of lines in a file.
-// It also updates the global Counts map, TotalLines variable, and Files list.
-func CountLines(filePath string, content []byte) (int, error) {
-	base := filepath.Base(filePath)
-	dot := strings.Index(base, ".")
-	if dot == -1 {
-		// No extension, return 0
-		return 0, nil
-	}
-	extension := base[dot:]
+// It also updates the result's Counts map, TotalLines, and Files list.
+// It is safe to call from multiple goroutines.
+func (r *Result) CountLines(filePath string, content []byte) (int, error) {
+	c := countFile(filePath, content, "")
+	r.record(filePath, c)
+	return c.Count, nil
+}
 
-	// detect language, extension is fallback
-	ftype := enry.GetLanguage(filepath.Base(filePath), content)
-	if ftype == "" {
-		ftype = extension
+// countFile detects the filetype of a file and counts its lines by kind.
+// A non-empty language overrides the detected filetype.
+func countFile(filePath string, content []byte, language string) FileCount {
+	c := FileCount{Filetype: language}
+	if c.Filetype == "" {
+		c.Filetype = detectFiletype(filePath, content)
 	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		return 0, err
+	for _, kind := range classifyLines(c.Filetype, content) {
+		c.add(kind, 1)
 	}
-	defer file.Close()
+	return c
+}
 
-	c, err := lineCounter(file)
-	if err != nil {
-		log.Println(err)
-		return 0, err
+// detectFiletype returns the language of a file. enry tries, in order,
+// modelines, well known filenames (Makefile, Dockerfile, ...), shebangs,
+// extensions and content heuristics, using its classifier only to pick
+// between several candidates. Files it can't identify are grouped by
+// their last extension, or as UnknownFiletype if they have none.
+func detectFiletype(filePath string, content []byte) string {
+	base := filepath.Base(filePath)
+	if ftype := enry.GetLanguage(base, content); ftype != "" {
+		return ftype
+	}
+	if extension := filepath.Ext(base); extension != "" {
+		return extension
 	}
+	return UnknownFiletype
+}
+
+// record adds a counted file to the result.
+func (r *Result) record(filePath string, c FileCount) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
 
 	// Update counts for this file type
-	if _, ok := Counts[ftype]; !ok {
-		Counts[ftype] = FileCount{Filetype: ftype, Count: 0}
-	}
-	Counts[ftype] = FileCount{Filetype: ftype, Count: Counts[ftype].Count + c}
+	ftCount := r.Counts[c.Filetype]
+	ftCount.Filetype = c.Filetype
+	ftCount.merge(c)
+	r.Counts[c.Filetype] = ftCount
 
 	// record the file
-	Files = append(Files, ValidFile{Filetype: ftype, Path: filePath})
+	r.Files = append(r.Files, ValidFile{Filetype: c.Filetype, Path: filePath, Lines: c})
 
-	// Update the total lines count
-	TotalLines = TotalLines + c
-
-	return c, nil
+	// Update the totals
+	r.Totals.merge(c)
+	r.TotalLines = r.Totals.Count
 }
 
-// Reads from r in chunks and counts the number of lines.
-func lineCounter(r io.Reader) (int, error) {
-	buf := make([]byte, 32*1024)
-	count := 0
-	lineSep := []byte{'\n'}
-
-	for {
-		c, err := r.Read(buf)
-		count += bytes.Count(buf[:c], lineSep)
-
-		switch {
-		case err == io.EOF:
-			return count, nil
-
-		case err != nil:
-			return count, err
-		}
+// add counts n lines of kind.
+func (c *FileCount) add(kind lineKind, n int) {
+	c.Count += n
+	switch kind {
+	case lineCode:
+		c.Code += n
+	case lineComment:
+		c.Comment += n
+	case lineBlank:
+		c.Blank += n
 	}
 }
+
+// merge adds the lines counted in other.
+func (c *FileCount) merge(other FileCount) {
+	c.Count += other.Count
+	c.Code += other.Code
+	c.Comment += other.Comment
+	c.Blank += other.Blank
+}
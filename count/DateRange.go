@@ -0,0 +1,103 @@
+/*
+count/DateRange.go
+
+Date range used to restrict blame attribution to lines last changed
+within a window of time, along with parsing helpers for the
+--since and --until flags and the TUI range input.
+*/
+
+package count
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Restricts blame attribution to lines whose commit falls within
+// [Since, Until]. A zero Since or Until leaves that side open.
+type DateRange struct {
+	Since time.Time
+	Until time.Time
+}
+
+// IsZero reports whether the range is open on both sides.
+func (d DateRange) IsZero() bool {
+	return d.Since.IsZero() && d.Until.IsZero()
+}
+
+// IsOlder reports whether t is before the start of the range.
+func (d DateRange) IsOlder(t time.Time) bool {
+	return !d.Since.IsZero() && t.Before(d.Since)
+}
+
+// IsNewer reports whether t is after the end of the range.
+func (d DateRange) IsNewer(t time.Time) bool {
+	return !d.Until.IsZero() && t.After(d.Until)
+}
+
+// String formats the range as "since..until", leaving open sides empty.
+func (d DateRange) String() string {
+	var since, until string
+	if !d.Since.IsZero() {
+		since = d.Since.Format(dateLayout)
+	}
+	if !d.Until.IsZero() {
+		until = d.Until.Format(dateLayout)
+	}
+	return since + ".." + until
+}
+
+// ParseDateRange builds a range from since and until strings, either of
+// which may be empty. Dates are YYYY-MM-DD or RFC 3339. A date-only
+// until includes the whole of that day.
+func ParseDateRange(since, until string) (DateRange, error) {
+	var d DateRange
+	var err error
+	if since != "" {
+		if d.Since, _, err = parseDate(since); err != nil {
+			return DateRange{}, fmt.Errorf("invalid since date: %w", err)
+		}
+	}
+	if until != "" {
+		var dateOnly bool
+		if d.Until, dateOnly, err = parseDate(until); err != nil {
+			return DateRange{}, fmt.Errorf("invalid until date: %w", err)
+		}
+		if dateOnly {
+			d.Until = d.Until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+	}
+	if !d.Since.IsZero() && !d.Until.IsZero() && d.Until.Before(d.Since) {
+		return DateRange{}, fmt.Errorf("until %s is before since %s", until, since)
+	}
+	return d, nil
+}
+
+// ParseDateRangeString parses the "since..until" form produced by String.
+func ParseDateRangeString(s string) (DateRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DateRange{}, nil
+	}
+	since, until, ok := strings.Cut(s, "..")
+	if !ok {
+		return DateRange{}, fmt.Errorf("expected since..until, got %q", s)
+	}
+	return ParseDateRange(strings.TrimSpace(since), strings.TrimSpace(until))
+}
+
+// parseDate parses s as YYYY-MM-DD in local time or as RFC 3339. The
+// returned bool is true when s only contained a date.
+func parseDate(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(dateLayout, s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%q is not YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, false, nil
+}
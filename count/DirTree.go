@@ -0,0 +1,138 @@
+/*
+count/DirTree.go
+
+Aggregates line and blame counts up the directory hierarchy. Every
+directory holding counted files, along with each of its ancestors,
+gets a node with the lines in and below it by filetype and, once
+blamed, by author. Trees are rebuilt rather than updated when the
+blame is tallied again, so a tree handed to the TUI is never modified.
+*/
+
+package count
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// Counts for a directory and every directory below it
+type DirNode struct {
+	// Base name of the directory, "" for the root
+	Name string
+	// Slash separated path relative to the scanned directory, "" for the root
+	Path string
+	// Number of counted files
+	Files int
+	Lines FileCount
+
+	LinesByType map[string]*FileCount
+	// Lines attributed to each author within the date range
+	LinesByAuthor map[string]int
+
+	// Keys sorted by count
+	SortedTypeKeys   []string
+	SortedAuthorKeys []string
+
+	// Subdirectories sorted by name
+	Children []*DirNode
+	parent   *DirNode
+}
+
+func newDirNode(name, dirPath string, parent *DirNode) *DirNode {
+	return &DirNode{
+		Name:          name,
+		Path:          dirPath,
+		Lines:         FileCount{Filetype: "Total"},
+		LinesByType:   make(map[string]*FileCount),
+		LinesByAuthor: make(map[string]int),
+		parent:        parent,
+	}
+}
+
+// fileDir returns the directory of a counted file relative to root,
+// as used for the node paths.
+func fileDir(root, filePath string) string {
+	return relativeSlashPath(root, filepath.Dir(filePath))
+}
+
+// dirTree builds the directory tree of the result's files. blame holds
+// the lines attributed to each author by directory, nil before blaming.
+// Callers must hold the result's lock.
+func (r *Result) dirTree(blame map[string]map[string]int) *DirNode {
+	root := newDirNode("", "", nil)
+	nodes := map[string]*DirNode{"": root}
+
+	for _, f := range r.Files {
+		for node := dirNodeFor(nodes, fileDir(r.root, f.Path)); node != nil; node = node.parent {
+			node.Files++
+			node.Lines.merge(f.Lines)
+			if _, ok := node.LinesByType[f.Filetype]; !ok {
+				node.LinesByType[f.Filetype] = &FileCount{Filetype: f.Filetype}
+			}
+			node.LinesByType[f.Filetype].merge(f.Lines)
+		}
+	}
+
+	for dir, authors := range blame {
+		for node := dirNodeFor(nodes, dir); node != nil; node = node.parent {
+			for author, n := range authors {
+				node.LinesByAuthor[author] += n
+			}
+		}
+	}
+
+	root.sortKeys()
+	return root
+}
+
+// dirNodeFor returns the node for dir, creating it and any missing
+// ancestors.
+func dirNodeFor(nodes map[string]*DirNode, dir string) *DirNode {
+	if node, ok := nodes[dir]; ok {
+		return node
+	}
+	parentDir := path.Dir(dir)
+	if parentDir == "." {
+		parentDir = ""
+	}
+	parent := dirNodeFor(nodes, parentDir)
+	node := newDirNode(path.Base(dir), dir, parent)
+	parent.Children = append(parent.Children, node)
+	nodes[dir] = node
+	return node
+}
+
+// Sort the keys and children of the node and every node below it
+func (n *DirNode) sortKeys() {
+	n.SortedTypeKeys = make([]string, 0, len(n.LinesByType))
+	for k := range n.LinesByType {
+		n.SortedTypeKeys = append(n.SortedTypeKeys, k)
+	}
+	sort.Slice(n.SortedTypeKeys, func(i, j int) bool {
+		a, b := n.LinesByType[n.SortedTypeKeys[i]].Count, n.LinesByType[n.SortedTypeKeys[j]].Count
+		if a != b {
+			return a > b
+		}
+		return n.SortedTypeKeys[i] < n.SortedTypeKeys[j]
+	})
+
+	n.SortedAuthorKeys = make([]string, 0, len(n.LinesByAuthor))
+	for k := range n.LinesByAuthor {
+		n.SortedAuthorKeys = append(n.SortedAuthorKeys, k)
+	}
+	sort.Slice(n.SortedAuthorKeys, func(i, j int) bool {
+		a, b := n.LinesByAuthor[n.SortedAuthorKeys[i]], n.LinesByAuthor[n.SortedAuthorKeys[j]]
+		if a != b {
+			return a > b
+		}
+		return n.SortedAuthorKeys[i] < n.SortedAuthorKeys[j]
+	})
+
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, child := range n.Children {
+		child.sortKeys()
+	}
+}
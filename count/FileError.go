@@ -0,0 +1,62 @@
+/*
+count/FileError.go
+
+Per-file failures collected during a scan. A file or directory that
+can't be read, for example because of its permissions or because it
+was removed mid-scan, is recorded in the Result with the phase it
+failed in and the scan carries on. In strict mode the first failure
+stops the scan instead.
+*/
+
+package count
+
+import "sort"
+
+// Phase of the scan a file failed in
+type ErrorPhase string
+
+const (
+	// Listing a directory or reading its .gitignore
+	PhaseWalk ErrorPhase = "walk"
+	// Reading a file's contents
+	PhaseRead ErrorPhase = "read"
+)
+
+type FileError struct {
+	Path  string
+	Phase ErrorPhase
+	// Err's message, as errors don't marshal to JSON
+	Message string
+	Err     error `json:"-"`
+}
+
+// Handles a failure on a single file or directory. It returns nil to
+// carry on with the scan, or the error to stop it.
+type errorFunc func(path string, phase ErrorPhase, err error) error
+
+// onError returns the errorFunc used by a scan with opts, recording
+// failures in r unless the scan is strict.
+func (r *Result) onError(opts Options) errorFunc {
+	return func(path string, phase ErrorPhase, err error) error {
+		if opts.Strict {
+			return err
+		}
+		r.locker.Lock()
+		defer r.locker.Unlock()
+		r.Errors = append(r.Errors, FileError{
+			Path:    path,
+			Phase:   phase,
+			Message: err.Error(),
+			Err:     err,
+		})
+		return nil
+	}
+}
+
+// sortErrors orders the failures by path, as they are recorded both
+// while enumerating and by the pipeline workers.
+func (r *Result) sortErrors() {
+	sort.SliceStable(r.Errors, func(i, j int) bool {
+		return r.Errors[i].Path < r.Errors[j].Path
+	})
+}
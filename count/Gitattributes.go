@@ -0,0 +1,339 @@
+/*
+count/Gitattributes.go
+
+Gitattributes parsing and lookup following gitattributes(5), used to
+honor the linguist overrides GitHub applies to its language stats:
+linguist-generated, linguist-vendored, linguist-documentation,
+linguist-detectable and linguist-language. Attributes are read from
+every .gitattributes down a file's path from the repository root,
+including those above a scanned subdirectory, followed by
+.git/info/attributes, and the most specific matching line wins for each attribute. Patterns
+use the same matching as gitignores, except negative patterns are
+not allowed and are skipped like git does.
+*/
+
+package count
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-enry/go-enry/v2"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// State of an attribute for a path
+type attrState int
+
+const (
+	attrUnspecified attrState = iota
+	attrSet
+	attrUnset
+	attrValue
+)
+
+// One attribute assignment on a gitattributes line
+type attrAssignment struct {
+	name  string
+	state attrState
+	value string
+}
+
+// A pattern and the attributes it assigns
+type attrLine struct {
+	pattern gitPattern
+	attrs   []attrAssignment
+}
+
+// The linguist attributes of a single file
+type linguistAttrs struct {
+	generated     attrState
+	vendored      attrState
+	documentation attrState
+	detectable    attrState
+	// Language from linguist-language, "" if unset
+	language string
+}
+
+// Reads the contents of a file by its slash separated path relative
+// to the repository root. Missing files return nil contents and no error.
+type attrReader func(rel string) ([]byte, error)
+
+// Lazily loaded gitattributes of a directory tree, safe for
+// concurrent use by the walk workers.
+type gitattributes struct {
+	root string
+	// Path of root within the repository, see OpenRepo
+	prefix string
+	read   attrReader
+	// Lines of .git/info/attributes, which take precedence over every directory
+	info []attrLine
+
+	locker sync.Mutex
+	// Parsed lines of each directory's .gitattributes by slash separated path
+	dirs map[string][]attrLine
+}
+
+// newGitattributes returns the attributes of the directory tree at
+// root, whose path within the repository at repoRoot is prefix,
+// reading .gitattributes files from disk and info/attributes from
+// gitDir. A directory outside of a repository is its own repoRoot and
+// has no gitDir.
+func newGitattributes(root, repoRoot, prefix, gitDir string) (*gitattributes, error) {
+	return newGitattributesFrom(root, prefix, gitDir, func(rel string) ([]byte, error) {
+		content, err := os.ReadFile(filepath.Join(repoRoot, filepath.FromSlash(rel)))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return content, err
+	})
+}
+
+// newTreeGitattributes returns the attributes of the tree of the commit
+// in repo resolved from rev, for files below root whose path within
+// the repository is prefix. The .gitattributes files are read up
+// front, as the repository handle isn't safe for concurrent use.
+func newTreeGitattributes(repo *git.Repository, root, prefix, rev string) (*gitattributes, error) {
+	commit, err := ResolveCommit(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the entries, so only the blobs of .gitattributes are read
+	files := make(map[string][]byte)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !entry.Mode.IsFile() || path.Base(name) != ".gitattributes" {
+			continue
+		}
+		if files[name], err = readBlob(repo, entry.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return newGitattributesFrom(root, prefix, repoCommonDir(repo), func(rel string) ([]byte, error) {
+		return files[rel], nil
+	})
+}
+
+func newGitattributesFrom(root, prefix, gitDir string, read attrReader) (*gitattributes, error) {
+	a := &gitattributes{
+		root:   root,
+		prefix: prefix,
+		read:   read,
+		dirs:   make(map[string][]attrLine),
+	}
+
+	if gitDir == "" {
+		return a, nil
+	}
+	info, err := os.ReadFile(filepath.Join(gitDir, "info", "attributes"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	a.info = parseGitattributes(info, "")
+	return a, nil
+}
+
+// parseGitattributes parses the lines of a gitattributes file whose
+// patterns are relative to base. Macro definitions, quoted patterns
+// and negative patterns are skipped.
+func parseGitattributes(content []byte, base string) []attrLine {
+	var lines []attrLine
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") ||
+			strings.HasPrefix(fields[0], "[attr]") || strings.HasPrefix(fields[0], `"`) {
+			continue
+		}
+		pattern, ok := parseGitPattern(fields[0], base)
+		if !ok || pattern.negate {
+			continue
+		}
+
+		line := attrLine{pattern: pattern}
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "-"):
+				line.attrs = append(line.attrs, attrAssignment{name: field[1:], state: attrUnset})
+			case strings.HasPrefix(field, "!"):
+				line.attrs = append(line.attrs, attrAssignment{name: field[1:], state: attrUnspecified})
+			default:
+				name, value, ok := strings.Cut(field, "=")
+				if ok {
+					line.attrs = append(line.attrs, attrAssignment{name: name, state: attrValue, value: value})
+				} else {
+					line.attrs = append(line.attrs, attrAssignment{name: name, state: attrSet})
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// dirLines returns the parsed .gitattributes of the slash separated
+// directory dir, reading it on first use.
+func (a *gitattributes) dirLines(dir string) []attrLine {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	if lines, ok := a.dirs[dir]; ok {
+		return lines
+	}
+	// An unreadable .gitattributes applies no attributes, like a missing one
+	content, _ := a.read(path.Join(dir, ".gitattributes"))
+	lines := parseGitattributes(content, dir)
+	a.dirs[dir] = lines
+	return lines
+}
+
+// linguist returns the linguist attributes of the file at filePath.
+func (a *gitattributes) linguist(filePath string) linguistAttrs {
+	var attrs linguistAttrs
+	if a == nil {
+		return attrs
+	}
+	rel := repoPath(a.root, a.prefix, filePath)
+
+	// Lowest precedence first: the root down to the file's directory,
+	// then .git/info/attributes
+	sources := [][]attrLine{a.dirLines("")}
+	if dir := path.Dir(rel); dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			sources = append(sources, a.dirLines(strings.Join(parts[:i+1], "/")))
+		}
+	}
+	sources = append(sources, a.info)
+
+	// Later lines win, so the first assignment found walking backwards decides
+	decided := make(map[string]bool)
+	for s := len(sources) - 1; s >= 0; s-- {
+		for l := len(sources[s]) - 1; l >= 0; l-- {
+			line := sources[s][l]
+			if !line.pattern.match(rel, false) {
+				continue
+			}
+			for i := len(line.attrs) - 1; i >= 0; i-- {
+				assignment := line.attrs[i]
+				if decided[assignment.name] {
+					continue
+				}
+				decided[assignment.name] = true
+				attrs.apply(assignment)
+			}
+		}
+	}
+	return attrs
+}
+
+// apply records a linguist attribute assignment.
+func (l *linguistAttrs) apply(assignment attrAssignment) {
+	// Values other than false set boolean attributes, like linguist
+	state := assignment.state
+	if state == attrValue {
+		state = attrSet
+		if assignment.value == "false" {
+			state = attrUnset
+		}
+	}
+
+	switch assignment.name {
+	case "linguist-generated":
+		l.generated = state
+	case "linguist-vendored":
+		l.vendored = state
+	case "linguist-documentation":
+		l.documentation = state
+	case "linguist-detectable":
+		l.detectable = state
+	case "linguist-language":
+		if assignment.state == attrValue {
+			l.language = canonicalLanguage(assignment.value)
+		}
+	}
+}
+
+// canonicalLanguage returns the enry name of a linguist-language value,
+// which may be an alias such as "js" or use dashes for spaces.
+func canonicalLanguage(value string) string {
+	if lang, ok := enry.GetLanguageByAlias(value); ok {
+		return lang
+	}
+	if lang, ok := enry.GetLanguageByAlias(strings.ReplaceAll(value, "-", " ")); ok {
+		return lang
+	}
+	return value
+}
+
+// language returns the language set by linguist-language for the file
+// at filePath, or "" to detect it.
+func (a *gitattributes) language(filePath string) string {
+	return a.linguist(filePath).language
+}
+
+// -- Filter functions --
+
+// generatedFilter excludes generated files when enabled. The
+// linguist-generated attribute overrides enry's detection either way.
+func (a *gitattributes) generatedFilter(enabled bool) FilterFunc {
+	if !enabled {
+		return nil
+	}
+	return func(path string, content []byte) bool {
+		switch a.linguist(path).generated {
+		case attrSet:
+			return true
+		case attrUnset:
+			return false
+		}
+		return enry.IsGenerated(path, content)
+	}
+}
+
+// vendorFilter excludes vendored files when enabled. The
+// linguist-vendored attribute overrides enry's detection either way.
+func (a *gitattributes) vendorFilter(enabled bool) FilterFunc {
+	if !enabled {
+		return nil
+	}
+	return func(path string, _ []byte) bool {
+		switch a.linguist(path).vendored {
+		case attrSet:
+			return true
+		case attrUnset:
+			return false
+		}
+		return enry.IsVendor(path)
+	}
+}
+
+// linguistFilter excludes files GitHub leaves out of its language
+// stats: those marked linguist-documentation or -linguist-detectable.
+func (a *gitattributes) linguistFilter() FilterFunc {
+	return func(path string, _ []byte) bool {
+		attrs := a.linguist(path)
+		return attrs.documentation == attrSet || attrs.detectable == attrUnset
+	}
+}
@@ -0,0 +1,140 @@
+package count
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// newMapGitattributes returns the attributes of a repository whose
+// .gitattributes files are given by slash separated path, and whose
+// .git/info/attributes holds info, for files below its subdirectory
+// prefix.
+func newMapGitattributes(t *testing.T, files map[string]string, info, prefix string) (*gitattributes, string) {
+	t.Helper()
+	repo := t.TempDir()
+	gitDir := filepath.Join(repo, ".git")
+	writeFixtureFile(t, filepath.Join(gitDir, "info", "attributes"), info)
+	root := filepath.Join(repo, filepath.FromSlash(prefix))
+	a, err := newGitattributesFrom(root, prefix, gitDir, func(rel string) ([]byte, error) {
+		content, ok := files[rel]
+		if !ok {
+			return nil, nil
+		}
+		return []byte(content), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, root
+}
+
+func TestGitattributesLinguist(t *testing.T) {
+	files := map[string]string{
+		".gitattributes": "# comment\n" +
+			"*.js linguist-vendored\n" +
+			"*.gen.go linguist-generated\n" +
+			"docs/** linguist-documentation\n" +
+			"*.tpl linguist-language=js\n" +
+			"*.el linguist-language=Emacs-Lisp\n" +
+			"*.x linguist-language=NotALanguage\n" +
+			"*.txt linguist-detectable\n" +
+			"*.txt -linguist-detectable\n" +
+			"!*.js -linguist-vendored\n" +
+			"[attr]binary -diff\n",
+		"lib/.gitattributes": "*.js -linguist-vendored\n" +
+			"*.gen.go !linguist-generated\n" +
+			"keep.txt linguist-detectable=true\n",
+		"lib/deep/.gitattributes": "*.js linguist-vendored=false\n" +
+			"*.md linguist-documentation=false\n",
+	}
+	info := "override.js linguist-vendored\n"
+	a, root := newMapGitattributes(t, files, info, "")
+
+	tests := []struct {
+		path string
+		want linguistAttrs
+	}{
+		{"app.js", linguistAttrs{vendored: attrSet}},
+		// Deeper directories take precedence
+		{"lib/app.js", linguistAttrs{vendored: attrUnset}},
+		{"lib/deep/app.js", linguistAttrs{vendored: attrUnset}},
+		// .git/info/attributes takes precedence over every directory
+		{"lib/override.js", linguistAttrs{vendored: attrSet}},
+		// !attr resets the attribute to unspecified
+		{"x.gen.go", linguistAttrs{generated: attrSet}},
+		{"lib/x.gen.go", linguistAttrs{}},
+		// Later lines of the same file take precedence
+		{"notes.txt", linguistAttrs{detectable: attrUnset}},
+		{"lib/keep.txt", linguistAttrs{detectable: attrSet}},
+		{"docs/guide.md", linguistAttrs{documentation: attrSet}},
+		{"lib/deep/docs/guide.md", linguistAttrs{documentation: attrUnset}},
+		// Languages are canonicalized from aliases
+		{"page.tpl", linguistAttrs{language: "JavaScript"}},
+		{"init.el", linguistAttrs{language: "Emacs Lisp"}},
+		{"a.x", linguistAttrs{language: "NotALanguage"}},
+		{"main.go", linguistAttrs{}},
+	}
+	for _, tt := range tests {
+		got := a.linguist(filepath.Join(root, filepath.FromSlash(tt.path)))
+		if got != tt.want {
+			t.Errorf("linguist(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestGitattributesSubdirectory checks that a scan of a subdirectory
+// applies the attributes of the directories above it.
+func TestGitattributesSubdirectory(t *testing.T) {
+	files := map[string]string{
+		".gitattributes":     "*.js linguist-vendored\nsub/gen/* linguist-generated\n",
+		"sub/.gitattributes": "/local.js -linguist-vendored\n",
+	}
+	a, root := newMapGitattributes(t, files, "", "sub")
+
+	tests := []struct {
+		path string
+		want linguistAttrs
+	}{
+		{"app.js", linguistAttrs{vendored: attrSet}},
+		{"local.js", linguistAttrs{vendored: attrUnset}},
+		{"nested/local.js", linguistAttrs{vendored: attrSet}},
+		{"gen/x.go", linguistAttrs{generated: attrSet}},
+	}
+	for _, tt := range tests {
+		got := a.linguist(filepath.Join(root, filepath.FromSlash(tt.path)))
+		if got != tt.want {
+			t.Errorf("linguist(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestTreeGitattributes checks that the .gitattributes files of a
+// commit's tree are read, rather than those in the working tree.
+func TestTreeGitattributes(t *testing.T) {
+	requireGit(t)
+	repo, _ := newBlameFixture(t)
+	writeFixtureFile(t, filepath.Join(repo, ".gitattributes"), "*.go linguist-generated\n")
+	writeFixtureFile(t, filepath.Join(repo, "docs", ".gitattributes"), "*.txt linguist-documentation\n")
+	gitCommit(t, repo, "Alice", 10)
+	writeFixtureFile(t, filepath.Join(repo, ".gitattributes"), "*.go -linguist-generated\n")
+
+	r, err := git.PlainOpen(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newTreeGitattributes(r, repo, "", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.linguist(filepath.Join(repo, "main.go")); got.generated != attrSet {
+		t.Errorf("main.go generated = %v, want set", got.generated)
+	}
+	if got := a.linguist(filepath.Join(repo, "docs", "my notes.txt")); got.documentation != attrSet {
+		t.Errorf("docs/my notes.txt documentation = %v, want set", got.documentation)
+	}
+	if got := a.linguist(filepath.Join(repo, "util.go")); got.documentation != attrUnspecified {
+		t.Errorf("util.go documentation = %v, want unspecified", got.documentation)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+count/Gitignore.go
+
+Gitignore pattern parsing and matching following the rules documented
+in gitignore(5). Patterns are collected from the global excludes file,
+.git/info/exclude and every .gitignore down the walked path, and are
+evaluated in git's order of precedence (last matching pattern wins).
+*/
+
+package count
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/go-git/go-git/v5/plumbing/format/config"
+)
+
+// A single parsed gitignore pattern.
+type gitPattern struct {
+	base     string // slash separated directory the pattern is relative to, "" for the root
+	glob     string // doublestar compatible glob
+	negate   bool   // pattern began with "!"
+	dirOnly  bool   // pattern ended with "/"
+	anchored bool   // pattern contained a "/" and only matches relative to base
+}
+
+// Ordered list of patterns, lowest precedence first.
+type gitignore []gitPattern
+
+// parseGitPattern parses one line of a gitignore style file. The returned
+// bool is false for blank lines and comments.
+func parseGitPattern(line, base string) (gitPattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitPattern{}, false
+	}
+
+	p := gitPattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return gitPattern{}, false
+	}
+
+	// git has no brace expansion, so braces are always literal
+	line = strings.ReplaceAll(line, "{", "\\{")
+	line = strings.ReplaceAll(line, "}", "\\}")
+	p.glob = line
+	return p, true
+}
+
+// match reports whether the slash separated path rel (relative to the walk
+// root) matches the pattern.
+func (p gitPattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		var ok bool
+		rel, ok = strings.CutPrefix(rel, p.base+"/")
+		if !ok {
+			return false
+		}
+	}
+
+	// Patterns without a slash match the name at any depth below base
+	if !p.anchored {
+		matched, err := doublestar.Match(p.glob, path.Base(rel))
+		return err == nil && matched
+	}
+
+	matched, err := doublestar.Match(p.glob, rel)
+	if err != nil || !matched {
+		return false
+	}
+	// "foo/**" matches everything inside foo, but not foo itself
+	if prefix, ok := strings.CutSuffix(p.glob, "/**"); ok {
+		if self, err := doublestar.Match(prefix, rel); err == nil && self {
+			return false
+		}
+	}
+	return true
+}
+
+// with returns a new gitignore with patterns appended at a higher precedence.
+func (g gitignore) with(patterns []gitPattern) gitignore {
+	if len(patterns) == 0 {
+		return g
+	}
+	combined := make(gitignore, 0, len(g)+len(patterns))
+	combined = append(combined, g...)
+	return append(combined, patterns...)
+}
+
+// Checks if the slash separated path rel is ignored. The last matching
+// pattern decides, so a negated pattern can re-include a path excluded
+// by an earlier one.
+func (g gitignore) isIgnored(rel string, isDir bool) bool {
+	for i := len(g) - 1; i >= 0; i-- {
+		if g[i].match(rel, isDir) {
+			return !g[i].negate
+		}
+	}
+	return false
+}
+
+// readGitPatterns reads all patterns in the file at filePath, relative to
+// base. A missing file is not an error.
+func readGitPatterns(filePath, base string) ([]gitPattern, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []gitPattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := parseGitPattern(scanner.Text(), base); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// loadGitignore reads the .gitignore in dir. rel is the slash separated
+// path of dir relative to the walk root.
+func loadGitignore(dir, rel string) ([]gitPattern, error) {
+	return readGitPatterns(filepath.Join(dir, ".gitignore"), rel)
+}
+
+// loadParentGitignores reads the .gitignore files of the directories
+// from the repository root at root down to the parent of prefix, the
+// slash separated path of a scanned subdirectory.
+func loadParentGitignores(root, prefix string) (gitignore, error) {
+	var patterns gitignore
+	if prefix == "" {
+		return patterns, nil
+	}
+	dir := ""
+	for _, part := range strings.Split(prefix, "/") {
+		current, err := loadGitignore(filepath.Join(root, filepath.FromSlash(dir)), dir)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, current...)
+		dir = path.Join(dir, part)
+	}
+	return patterns, nil
+}
+
+// loadRepoExcludes reads the patterns that apply to the whole repository
+// with the git directory gitDir: the global excludes file followed by
+// info/exclude. gitDir is "" outside of a repository.
+func loadRepoExcludes(gitDir string) (gitignore, error) {
+	var patterns gitignore
+
+	if excludesFile := excludesFilePath(gitDir); excludesFile != "" {
+		global, err := readGitPatterns(excludesFile, "")
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, global...)
+	}
+
+	if gitDir != "" {
+		local, err := readGitPatterns(filepath.Join(gitDir, "info", "exclude"), "")
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, local...)
+	}
+
+	return patterns, nil
+}
+
+// excludesFilePath resolves core.excludesFile the same way git does: the
+// repository config wins over the user's config files, which win over the
+// system config. When unset, git falls back to $XDG_CONFIG_HOME/git/ignore.
+func excludesFilePath(gitDir string) string {
+	home, _ := os.UserHomeDir()
+	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" && home != "" {
+		xdgConfig = filepath.Join(home, ".config")
+	}
+
+	// Lowest precedence first
+	configFiles := []string{"/etc/gitconfig"}
+	if xdgConfig != "" {
+		configFiles = append(configFiles, filepath.Join(xdgConfig, "git", "config"))
+	}
+	if home != "" {
+		configFiles = append(configFiles, filepath.Join(home, ".gitconfig"))
+	}
+	if gitDir != "" {
+		configFiles = append(configFiles, filepath.Join(gitDir, "config"))
+	}
+
+	excludesFile := ""
+	for _, cf := range configFiles {
+		if v := readConfigOption(cf, "core", "excludesfile"); v != "" {
+			excludesFile = v
+		}
+	}
+
+	if excludesFile == "" {
+		if xdgConfig == "" {
+			return ""
+		}
+		return filepath.Join(xdgConfig, "git", "ignore")
+	}
+	if rest, ok := strings.CutPrefix(excludesFile, "~/"); ok && home != "" {
+		excludesFile = filepath.Join(home, rest)
+	}
+	return excludesFile
+}
+
+// readConfigOption returns the value of section.key in the git config file
+// at path, or "" if the file or option does not exist.
+func readConfigOption(path, section, key string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	cfg := config.New()
+	if err := config.NewDecoder(f).Decode(cfg); err != nil {
+		return ""
+	}
+	return cfg.Section(section).Option(key)
+}
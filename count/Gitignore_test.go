@@ -0,0 +1,315 @@
+package count
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Root .gitignore of the fixture, covering the rules of gitignore(5).
+// Lines with trailing spaces are added separately so they survive
+// editors trimming them.
+const fixtureGitignore = `# comment
+*.log
+!keep.log
+build/
+/root-only.txt
+docs/internal.md
+**/gen/*.go
+vendor/**
+a/**/b
+\#hash.txt
+\!bang.txt
+excluded/
+!excluded/inside.txt
+out/*
+!out/keep.txt
+` + "trailing\\ \n" + "spaced   \n"
+
+// Whether each file of the fixture is ignored, as reported by
+// git check-ignore, see TestGitignoreMatchesGit
+var fixtureIgnored = []struct {
+	path    string
+	ignored bool
+}{
+	{"app.log", true},
+	{"keep.log", false},
+	{"build/x.go", true},
+	{"src/build/y.go", true},
+	{"sub/build", false},
+	{"root-only.txt", true},
+	{"sub/root-only.txt", false},
+	{"docs/internal.md", true},
+	{"x/docs/internal.md", false},
+	{"gen/a.go", true},
+	{"p/gen/b.go", true},
+	{"p/gen/c.txt", false},
+	{"vendor/v.go", true},
+	{"vendor/deep/w.go", true},
+	{"a/b", true},
+	{"a/x/y/b", true},
+	{"a/c", false},
+	{"#hash.txt", true},
+	{"!bang.txt", true},
+	{"trailing ", true},
+	{"spaced", true},
+	{"excluded/inside.txt", true},
+	{"out/drop.txt", true},
+	{"out/keep.txt", false},
+	{"sub/local.txt", true},
+	{"sub/deeper/local.txt", false},
+	{"sub/important.log", false},
+	{"note.tmp", true},
+	{"note.bak", true},
+	{"main.go", false},
+}
+
+// newIgnoreFixture creates an empty repository with the fixture's
+// .gitignore files, info/exclude and a core.excludesFile, and every
+// file of fixtureIgnored. HOME and XDG_CONFIG_HOME point into the
+// fixture, so the user's own excludes don't apply.
+func newIgnoreFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := filepath.Join(dir, "repo")
+	globalIgnore := filepath.Join(home, "global-ignore")
+	files := map[string]string{
+		".git/HEAD":         "ref: refs/heads/master\n",
+		".git/config":       "[core]\n\trepositoryformatversion = 0\n\tbare = false\n\texcludesFile = " + filepath.ToSlash(globalIgnore) + "\n",
+		".git/info/exclude": "*.tmp\n",
+		".gitignore":        fixtureGitignore,
+		"sub/.gitignore":    "/local.txt\n!important.log\n",
+	}
+	for _, f := range fixtureIgnored {
+		files[f.path] = "x\n"
+	}
+	for name, content := range files {
+		writeFixtureFile(t, filepath.Join(repo, filepath.FromSlash(name)), content)
+	}
+	writeFixtureFile(t, globalIgnore, "*.bak\n")
+	for _, d := range []string{".git/objects", ".git/refs/heads"} {
+		if err := os.MkdirAll(filepath.Join(repo, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func writeFixtureFile(t testing.TB, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseGitPattern(t *testing.T) {
+	tests := []struct {
+		line string
+		want gitPattern
+		ok   bool
+	}{
+		{line: "", ok: false},
+		{line: "# comment", ok: false},
+		{line: "   ", ok: false},
+		{line: "/", ok: false},
+		{line: "*.log", want: gitPattern{glob: "*.log"}, ok: true},
+		{line: "!keep.log", want: gitPattern{glob: "keep.log", negate: true}, ok: true},
+		{line: "build/", want: gitPattern{glob: "build", dirOnly: true}, ok: true},
+		{line: "/root-only.txt", want: gitPattern{glob: "root-only.txt", anchored: true}, ok: true},
+		{line: "docs/internal.md", want: gitPattern{glob: "docs/internal.md", anchored: true}, ok: true},
+		{line: "**/gen/*.go", want: gitPattern{glob: "**/gen/*.go", anchored: true}, ok: true},
+		{line: "vendor/**", want: gitPattern{glob: "vendor/**", anchored: true}, ok: true},
+		{line: "a/**/b", want: gitPattern{glob: "a/**/b", anchored: true}, ok: true},
+		{line: "out/", want: gitPattern{glob: "out", dirOnly: true}, ok: true},
+		{line: "/out/", want: gitPattern{glob: "out", dirOnly: true, anchored: true}, ok: true},
+		{line: `\#hash.txt`, want: gitPattern{glob: `\#hash.txt`}, ok: true},
+		{line: `\!bang.txt`, want: gitPattern{glob: `\!bang.txt`}, ok: true},
+		{line: `trailing\ `, want: gitPattern{glob: `trailing\ `}, ok: true},
+		{line: "spaced   ", want: gitPattern{glob: "spaced"}, ok: true},
+		{line: "crlf\r", want: gitPattern{glob: "crlf"}, ok: true},
+		{line: "a{b,c}", want: gitPattern{glob: `a\{b,c\}`}, ok: true},
+	}
+	for _, tt := range tests {
+		got, ok := parseGitPattern(tt.line, "")
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseGitPattern(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGitPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		base    string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Patterns without a slash match at any depth
+		{"*.log", "", "app.log", false, true},
+		{"*.log", "", "deep/dir/app.log", false, true},
+		// A leading or middle slash anchors the pattern to its base
+		{"/root-only.txt", "", "root-only.txt", false, true},
+		{"/root-only.txt", "", "sub/root-only.txt", false, false},
+		{"docs/internal.md", "", "docs/internal.md", false, true},
+		{"docs/internal.md", "", "x/docs/internal.md", false, false},
+		{"/local.txt", "sub", "sub/local.txt", false, true},
+		{"/local.txt", "sub", "local.txt", false, false},
+		{"/local.txt", "sub", "sub/deeper/local.txt", false, false},
+		// Leading **/ matches in all directories
+		{"**/gen/*.go", "", "gen/a.go", false, true},
+		{"**/gen/*.go", "", "p/q/gen/a.go", false, true},
+		{"**/gen/*.go", "", "p/gen/c.txt", false, false},
+		// Trailing /** matches everything inside, but not the directory
+		{"vendor/**", "", "vendor/v.go", false, true},
+		{"vendor/**", "", "vendor/deep/w.go", false, true},
+		{"vendor/**", "", "vendor", true, false},
+		// Middle /**/ matches zero or more directories
+		{"a/**/b", "", "a/b", false, true},
+		{"a/**/b", "", "a/x/y/b", false, true},
+		{"a/**/b", "", "a/c", false, false},
+		// Escaped special characters are literal
+		{`\#hash.txt`, "", "#hash.txt", false, true},
+		{`\!bang.txt`, "", "!bang.txt", false, true},
+		{`trailing\ `, "", "trailing ", false, true},
+		{`trailing\ `, "", "trailing", false, false},
+		// Braces are literal
+		{"a{b,c}", "", "a{b,c}", false, true},
+		{"a{b,c}", "", "ab", false, false},
+		// Directory only patterns skip files of the same name
+		{"build/", "", "build", true, true},
+		{"build/", "", "src/build", true, true},
+		{"build/", "", "sub/build", false, false},
+	}
+	for _, tt := range tests {
+		p, ok := parseGitPattern(tt.pattern, tt.base)
+		if !ok {
+			t.Fatalf("parseGitPattern(%q) failed", tt.pattern)
+		}
+		if got := p.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%q (base %q).match(%q, %v) = %v, want %v", tt.pattern, tt.base, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+// fixtureIgnore returns the patterns that apply to the fixture path
+// rel, collected like walkDir does.
+func fixtureIgnore(t *testing.T, repo, rel string) gitignore {
+	t.Helper()
+	ignore, err := loadRepoExcludes(filepath.Join(repo, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs := []string{""}
+	if d := path.Dir(rel); d != "." {
+		parts := strings.Split(d, "/")
+		for i := range parts {
+			dirs = append(dirs, strings.Join(parts[:i+1], "/"))
+		}
+	}
+	for _, dir := range dirs {
+		patterns, err := loadGitignore(filepath.Join(repo, filepath.FromSlash(dir)), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ignore = ignore.with(patterns)
+	}
+	return ignore
+}
+
+// isFixtureIgnored reports whether rel is ignored. As in walkDir, paths
+// below an ignored directory are ignored, whatever their own patterns.
+func isFixtureIgnored(ignore gitignore, rel string) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if ignore.isIgnored(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return ignore.isIgnored(rel, false)
+}
+
+func TestGitignoreFixture(t *testing.T) {
+	repo := newIgnoreFixture(t)
+	for _, f := range fixtureIgnored {
+		ignore := fixtureIgnore(t, repo, f.path)
+		if got := isFixtureIgnored(ignore, f.path); got != f.ignored {
+			t.Errorf("%q ignored = %v, want %v", f.path, got, f.ignored)
+		}
+	}
+}
+
+// hasGit reports whether the git binary is available.
+func hasGit() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// requireGit skips the test if the git binary isn't available.
+func requireGit(t testing.TB) {
+	t.Helper()
+	if !hasGit() {
+		t.Skip("git is not on PATH")
+	}
+}
+
+// TestGitignoreMatchesGit checks the expectations of fixtureIgnored
+// against git check-ignore.
+func TestGitignoreMatchesGit(t *testing.T) {
+	requireGit(t)
+	repo := newIgnoreFixture(t)
+	for _, f := range fixtureIgnored {
+		cmd := exec.Command("git", "check-ignore", "-q", "--", f.path)
+		cmd.Dir = repo
+		err := cmd.Run()
+		if exit, ok := err.(*exec.ExitError); err != nil && (!ok || exit.ExitCode() != 1) {
+			t.Fatalf("git check-ignore %q: %v", f.path, err)
+		}
+		if got := err == nil; got != f.ignored {
+			t.Errorf("git check-ignore %q = %v, fixture expects %v", f.path, got, f.ignored)
+		}
+	}
+}
+
+// TestWalkMatchesGit checks that the walk finds the same files as
+// git ls-files --others --exclude-standard.
+func TestWalkMatchesGit(t *testing.T) {
+	requireGit(t)
+	repo := newIgnoreFixture(t)
+
+	cmd := exec.Command("git", "ls-files", "-z", "--others", "--exclude-standard")
+	cmd.Dir = repo
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	sort.Strings(want)
+
+	res, err := NewScanner(repo, IgnoreConfig{}, Options{}).Walk(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range res.Files {
+		got = append(got, relativeSlashPath(repo, f.Path))
+	}
+	sort.Strings(got)
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("walk found\n%s\ngit found\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -7,7 +7,20 @@ to check if a file should be ignored based on its path or content.
 
 package count
 
-import "github.com/go-enry/go-enry/v2"
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/go-enry/go-enry/v2"
+)
+
+// Gitignore style file listing paths to leave out of the count,
+// layered on top of .gitignore
+const WhodunnitIgnoreFile = ".whodunnitignore"
 
 type FilterFunc func(path string, content []byte) bool
 
@@ -20,6 +33,10 @@ type IgnoreConfig struct {
 	IgnoreConfigFiles    bool
 	IgnoreGeneratedFiles bool
 	IgnoreVendorFiles    bool
+	// Doublestar globs matched against paths relative to the root.
+	// Only files matching an include glob are counted if any are set.
+	Include []string
+	Exclude []string
 }
 
 func DefaultIgnoreConfig() IgnoreConfig {
@@ -95,3 +112,88 @@ func WithVendorFiles(enabled bool) FilterFunc {
 		return enry.IsVendor(path)
 	}
 }
+
+// ValidateGlobs checks that every pattern is a valid doublestar glob.
+func ValidateGlobs(patterns []string) error {
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid glob %q", pattern)
+		}
+	}
+	return nil
+}
+
+// WithExcludeGlobs ignores files below root matching any of the globs.
+// A glob matching a directory excludes everything inside it.
+func WithExcludeGlobs(root string, patterns []string) FilterFunc {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return func(filePath string, _ []byte) bool {
+		return matchesGlobs(patterns, relativeSlashPath(root, filePath))
+	}
+}
+
+// WithIncludeGlobs ignores files below root that don't match any of the
+// globs. A glob matching a directory includes everything inside it.
+func WithIncludeGlobs(root string, patterns []string) FilterFunc {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return func(filePath string, _ []byte) bool {
+		return !matchesGlobs(patterns, relativeSlashPath(root, filePath))
+	}
+}
+
+// matchesGlobs reports whether rel or one of its parent directories
+// matches any of the patterns.
+func matchesGlobs(patterns []string, rel string) bool {
+	for p := rel; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if matched, err := doublestar.Match(pattern, p); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithIgnoreFile ignores files below root matched by the gitignore style
+// files called name, read from every directory down the file's path.
+// Files inside an ignored directory can't be re-included, as with git.
+func WithIgnoreFile(root, name string) FilterFunc {
+	var locker sync.Mutex
+	dirs := make(map[string][]gitPattern)
+
+	// Patterns of the file in dir, read on first use. An unreadable
+	// file ignores nothing, like a missing one.
+	dirPatterns := func(dir string) []gitPattern {
+		locker.Lock()
+		defer locker.Unlock()
+		if patterns, ok := dirs[dir]; ok {
+			return patterns
+		}
+		patterns, _ := readGitPatterns(filepath.Join(root, filepath.FromSlash(dir), name), dir)
+		dirs[dir] = patterns
+		return patterns
+	}
+
+	return func(filePath string, _ []byte) bool {
+		rel := relativeSlashPath(root, filePath)
+
+		// Check each parent directory with the patterns above it, then the file
+		ignore := gitignore(dirPatterns(""))
+		parent := path.Dir(rel)
+		if parent != "." {
+			parts := strings.Split(parent, "/")
+			for i := range parts {
+				dir := strings.Join(parts[:i+1], "/")
+				if ignore.isIgnored(dir, true) {
+					return true
+				}
+				ignore = ignore.with(dirPatterns(dir))
+			}
+		}
+		return ignore.isIgnored(rel, false)
+	}
+}
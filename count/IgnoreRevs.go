@@ -0,0 +1,494 @@
+/*
+count/IgnoreRevs.go
+
+Support for ignoring revisions during blame, mirroring
+git blame --ignore-revs-file. Lines last changed by an ignored commit
+are mapped through the diff into that commit's parent and attributed
+to whoever last changed the corresponding parent line instead. Lines
+the commit replaced are matched by similarity as git does, and those
+that match none of the replaced lines stay with the ignored commit.
+*/
+
+package count
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const ignoreRevsFile = ".git-blame-ignore-revs"
+
+// Set of commits whose changes are looked past when attributing lines
+type IgnoreRevs map[plumbing.Hash]struct{}
+
+// LoadIgnoreRevs resolves the commits listed in the repository's
+// .git-blame-ignore-revs file along with the extra revs given on the
+// command line. The file is read from the work tree at root, or from
+// commit if it isn't there, as in a bare repository. Entries in the
+// file that are not in the repository are skipped, while unknown extra
+// revs are an error.
+func LoadIgnoreRevs(repo *git.Repository, root string, commit *object.Commit, revs []string) (IgnoreRevs, error) {
+	ignore := make(IgnoreRevs)
+
+	var reader io.Reader
+	f, err := openWorktreeFile(root, ignoreRevsFile)
+	switch {
+	case err == nil:
+		defer f.Close()
+		reader = f
+	case os.IsNotExist(err) && commit != nil:
+		if file, err := commit.File(ignoreRevsFile); err == nil {
+			contents, err := file.Reader()
+			if err != nil {
+				return nil, err
+			}
+			defer contents.Close()
+			reader = contents
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if reader != nil {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.Index(line, "#"); i != -1 {
+				line = line[:i]
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if hash, err := repo.ResolveRevision(plumbing.Revision(line)); err == nil {
+				ignore[*hash] = struct{}{}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rev := range revs {
+		hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return nil, fmt.Errorf("ignore-rev %s: %w", rev, err)
+		}
+		ignore[*hash] = struct{}{}
+	}
+
+	return ignore, nil
+}
+
+// Blames files while looking past ignored revisions. Results are cached
+// per commit and path, so a blamer should only be used for one file.
+type ignoringBlamer struct {
+	repo   *git.Repository
+	ignore IgnoreRevs
+	cache  map[string][]*git.Line
+}
+
+// blameFile blames path at commit, attributing lines from ignored
+// revisions to the previous commit that changed them.
+func blameFile(repo *git.Repository, commit *object.Commit, path string, ignore IgnoreRevs) ([]*git.Line, error) {
+	if len(ignore) == 0 {
+		blame, err := git.Blame(commit, path)
+		if err != nil {
+			return nil, err
+		}
+		return blame.Lines, nil
+	}
+
+	b := &ignoringBlamer{
+		repo:   repo,
+		ignore: ignore,
+		cache:  make(map[string][]*git.Line),
+	}
+	return b.blame(commit, path)
+}
+
+func (b *ignoringBlamer) blame(commit *object.Commit, path string) ([]*git.Line, error) {
+	key := commit.Hash.String() + ":" + path
+	if lines, ok := b.cache[key]; ok {
+		return lines, nil
+	}
+
+	result, err := git.Blame(commit, path)
+	if err != nil {
+		return nil, err
+	}
+	lines := result.Lines
+
+	// Group the lines blamed on each ignored commit
+	ignoredLines := make(map[plumbing.Hash][]int)
+	for i, line := range lines {
+		if _, ok := b.ignore[line.Hash]; ok {
+			ignoredLines[line.Hash] = append(ignoredLines[line.Hash], i)
+		}
+	}
+
+	if len(ignoredLines) > 0 {
+		contents, err := fileContents(commit, path)
+		if err != nil {
+			return nil, err
+		}
+		for hash, indexes := range ignoredLines {
+			if err := b.lookPast(hash, path, contents, lines, indexes); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	b.cache[key] = lines
+	return lines, nil
+}
+
+// lookPast re-attributes the lines at indexes, which are blamed on the
+// ignored commit hash, to the corresponding lines in its first parent.
+// Lines added by the ignored commit, including those in a replacement
+// that don't resemble any line they replaced, keep its attribution.
+func (b *ignoringBlamer) lookPast(hash plumbing.Hash, path, contents string, lines []*git.Line, indexes []int) error {
+	ignored, err := b.repo.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+	if ignored.NumParents() == 0 {
+		return nil
+	}
+	parent, err := ignored.Parent(0)
+	if err != nil {
+		return err
+	}
+
+	// Files renamed since the ignored commit can't be followed
+	ignoredContents, err := fileContents(ignored, path)
+	if err != nil {
+		return nil
+	}
+	parentContents, err := fileContents(parent, path)
+	if err != nil {
+		return nil
+	}
+
+	// Map lines from the blamed revision back to the ignored commit,
+	// then from the ignored commit into its parent
+	toIgnored := diffLineMap(ignoredContents, contents, false)
+	toParent := diffLineMap(parentContents, ignoredContents, true)
+
+	parentLines, err := b.blame(parent, path)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range indexes {
+		if i >= len(toIgnored) {
+			continue
+		}
+		ignoredLine := toIgnored[i]
+		if ignoredLine == -1 || ignoredLine >= len(toParent) {
+			continue
+		}
+		parentLine := toParent[ignoredLine]
+		if parentLine == -1 || parentLine >= len(parentLines) {
+			continue
+		}
+		replacement := *parentLines[parentLine]
+		replacement.Text = lines[i].Text
+		lines[i] = &replacement
+	}
+	return nil
+}
+
+// diffLineMap returns, for every line of dst, the index of the matching
+// line in src or -1. If matchReplaced is set, lines in a hunk that
+// replaced lines of src are matched to the most similar replaced line
+// with matchLines, following git's heuristic for ignored revisions.
+func diffLineMap(src, dst string, matchReplaced bool) []int {
+	var srcLines, dstLines []string
+	if matchReplaced {
+		srcLines, dstLines = splitLines(src), splitLines(dst)
+	}
+
+	var mapping []int
+	srcLine := 0
+	deleted, inserted := 0, []int(nil)
+
+	// Resolve a run of deletions and insertions
+	flush := func() {
+		if matchReplaced && deleted > 0 && len(inserted) > 0 {
+			dstLine := len(mapping)
+			matches := matchLines(srcLines[srcLine-deleted:srcLine], dstLines[dstLine:dstLine+len(inserted)])
+			for k, match := range matches {
+				if match != -1 {
+					inserted[k] = srcLine - deleted + match
+				}
+			}
+		}
+		mapping = append(mapping, inserted...)
+		deleted, inserted = 0, nil
+	}
+
+	for _, hunk := range diff.Do(src, dst) {
+		n := countHunkLines(hunk.Text)
+		switch hunk.Type {
+		case diffmatchpatch.DiffEqual:
+			flush()
+			for k := 0; k < n; k++ {
+				mapping = append(mapping, srcLine+k)
+			}
+			srcLine += n
+		case diffmatchpatch.DiffDelete:
+			deleted += n
+			srcLine += n
+		case diffmatchpatch.DiffInsert:
+			for k := 0; k < n; k++ {
+				inserted = append(inserted, -1)
+			}
+		}
+	}
+	flush()
+	return mapping
+}
+
+// splitLines splits contents into lines without their line endings.
+func splitLines(contents string) []string {
+	lines := strings.Split(contents, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Pairs of adjacent characters of a line and how often they occur.
+// Letters are lowercased and whitespace is folded into a single
+// separator, so lines are compared regardless of formatting.
+type fingerprint map[uint16]int
+
+func lineFingerprint(line string) fingerprint {
+	fp := make(fingerprint)
+	var prev uint16
+	for i := 0; i <= len(line); i++ {
+		var c uint16
+		if i < len(line) && !isSpace(line[i]) {
+			c = uint16(toLower(line[i]))
+		}
+		if pair := prev | c<<8; pair != 0 {
+			fp[pair]++
+		}
+		prev = c
+	}
+	return fp
+}
+
+// similarity returns the number of character pairs fp and other share.
+func (fp fingerprint) similarity(other fingerprint) int {
+	n := 0
+	for pair, count := range other {
+		n += min(fp[pair], count)
+	}
+	return n
+}
+
+// subtract removes the character pairs of other from fp, so a line
+// that was matched can only match the rest of fp again.
+func (fp fingerprint) subtract(other fingerprint) {
+	for pair, count := range other {
+		if fp[pair] <= count {
+			delete(fp, pair)
+		} else {
+			fp[pair] -= count
+		}
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// Certainties of lines not compared yet, and of lines that resemble none
+const (
+	certaintyUnknown = -1
+	certaintyNoMatch = -2
+)
+
+// Matches the lines of a hunk to the lines they replaced, see matchLines
+type lineMatcher struct {
+	a, b []fingerprint
+	// Replaced lines each line is compared with either side of the
+	// one at its proportional position, and the distance between lines
+	// whose results are affected by matching one of them
+	searchA, searchB int
+	// Similarity of replaced and replacing lines by index, scaled to
+	// prefer lines closer to the proportional position
+	similarities map[[2]int]int
+	// How much better each line matches its best line than the second
+	// best, and the indexes of both
+	certainty    []int
+	best, second []int
+}
+
+// matchLines returns, for every line of b, the index of the line of a
+// it most resembles, or -1 if it resembles none of them. It mirrors the
+// fuzzy matching of git blame --ignore-rev: the line matched with the
+// most certainty is fixed first, its characters are taken out of the
+// line it matched, and the lines before and after it are matched in
+// the same way on either side, so matches keep the order of the lines.
+// Several lines can match the same line, such as one split in two, as
+// long as they share characters that weren't already taken.
+func matchLines(a, b []string) []int {
+	m := &lineMatcher{
+		similarities: make(map[[2]int]int),
+		certainty:    make([]int, len(b)),
+		best:         make([]int, len(b)),
+		second:       make([]int, len(b)),
+	}
+	for _, line := range a {
+		m.a = append(m.a, lineFingerprint(line))
+	}
+	for _, line := range b {
+		m.b = append(m.b, lineFingerprint(line))
+	}
+	m.searchA = min(10, len(a)-1)
+	m.searchB = ((2*m.searchA+1)*len(b) - 1) / len(a)
+	for j := range b {
+		m.certainty[j] = certaintyUnknown
+		m.best[j] = -1
+	}
+
+	m.match(0, len(a), 0, len(b))
+
+	result := make([]int, len(b))
+	for j := range b {
+		result[j] = -1
+		if m.certainty[j] >= 0 {
+			result[j] = m.best[j]
+		}
+	}
+	return result
+}
+
+// closest returns the line of a at the proportional position of line
+// j of b.
+func (m *lineMatcher) closest(j int) int {
+	return (j*2 + 1) * len(m.a) / (len(m.b) * 2)
+}
+
+// match matches the lines of b in [startB, endB) to those of a in
+// [startA, endA).
+func (m *lineMatcher) match(startA, endA, startB, endB int) {
+	mostB, mostCertainty := -1, -1
+	for j := startB; j < endB; j++ {
+		m.findBest(startA, endA, j)
+		if m.certainty[j] > mostCertainty {
+			mostB, mostCertainty = j, m.certainty[j]
+		}
+	}
+	if mostB == -1 {
+		return
+	}
+	mostA := m.best[mostB]
+
+	// Other lines can't match the characters of the line in a taken by
+	// the most certain line, so results compared with it are dropped
+	m.a[mostA].subtract(m.b[mostB])
+	invalidateMin := max(startB, mostB-m.searchB)
+	invalidateMax := min(endB, mostB+m.searchB+1)
+	for j := invalidateMin; j < invalidateMax; j++ {
+		delete(m.similarities, [2]int{mostA, j})
+	}
+
+	// As are matches out of order with the most certain line
+	for j := mostB - 1; j >= invalidateMin; j-- {
+		if m.certainty[j] >= 0 && (m.best[j] >= mostA || m.second[j] >= mostA) {
+			m.certainty[j] = certaintyUnknown
+		}
+	}
+	for j := mostB + 1; j < invalidateMax; j++ {
+		if m.certainty[j] >= 0 && (m.best[j] <= mostA || m.second[j] <= mostA) {
+			m.certainty[j] = certaintyUnknown
+		}
+	}
+
+	if mostB > startB {
+		m.match(startA, mostA+1, startB, mostB)
+	}
+	if mostB+1 < endB {
+		m.match(mostA, endA, mostB+1, endB)
+	}
+}
+
+// findBest compares line j of b with the lines of a in [startA, endA)
+// near its proportional position, unless its certainty is known.
+func (m *lineMatcher) findBest(startA, endA, j int) {
+	if m.certainty[j] != certaintyUnknown {
+		return
+	}
+	closest := m.closest(j)
+	best, second := 0, 0
+	bestIndex, secondIndex := startA, startA
+	for i := max(startA, closest-m.searchA); i < min(endA, closest+m.searchA+1); i++ {
+		similarity, ok := m.similarities[[2]int{i, j}]
+		if !ok {
+			// Break ties in favour of lines closer to the position
+			similarity = m.a[i].similarity(m.b[j]) * (1000 - abs(i-closest))
+			m.similarities[[2]int{i, j}] = similarity
+		}
+		if similarity > best {
+			second, secondIndex = best, bestIndex
+			best, bestIndex = similarity, i
+		} else if similarity > second {
+			second, secondIndex = similarity, i
+		}
+	}
+
+	if best == 0 {
+		m.certainty[j] = certaintyNoMatch
+		m.best[j] = -1
+		return
+	}
+	// A line matching two lines equally well is less certain, but still
+	// more than one matching a single line poorly
+	m.certainty[j] = best*2 - second
+	m.best[j] = bestIndex
+	m.second[j] = secondIndex
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// countHunkLines returns the number of lines in a line mode diff hunk.
+func countHunkLines(text string) int {
+	n := strings.Count(text, "\n")
+	if !strings.HasSuffix(text, "\n") {
+		n++
+	}
+	return n
+}
+
+func fileContents(commit *object.Commit, path string) (string, error) {
+	file, err := commit.File(path)
+	if err != nil {
+		return "", err
+	}
+	return file.Contents()
+}
@@ -0,0 +1,106 @@
+package count
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []int
+	}{
+		{
+			name: "reindented",
+			a:    []string{"\tprintln(1)", "\tprintln(2)"},
+			b:    []string{"    println(1)", "    println(2)"},
+			want: []int{0, 1},
+		},
+		{
+			name: "split",
+			a:    []string{"call(first, second)"},
+			b:    []string{"call(first,", "\tsecond)"},
+			want: []int{0, 0},
+		},
+		{
+			name: "joined",
+			a:    []string{"var values = []int{", "\t1,", "\t2,", "}"},
+			b:    []string{"var values = []int{1, 2}"},
+			want: []int{0},
+		},
+		{
+			name: "added blank line",
+			a:    []string{"x := compute(a, b)"},
+			b:    []string{"x := compute(a, b)", ""},
+			want: []int{0, -1},
+		},
+		{
+			name: "added unrelated line",
+			a:    []string{"x := compute(a, b)"},
+			b:    []string{"// wrapped", "x := compute(a, b)"},
+			want: []int{-1, 0},
+		},
+		{
+			name: "case and whitespace",
+			a:    []string{"SELECT  name FROM users"},
+			b:    []string{"select name", "from users"},
+			want: []int{0, 0},
+		},
+	}
+	for _, tt := range tests {
+		if got := matchLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: matchLines = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiffLineMap(t *testing.T) {
+	tests := []struct {
+		name          string
+		src, dst      string
+		matchReplaced bool
+		want          []int
+	}{
+		{
+			name: "unchanged",
+			src:  "a\nb\nc\n",
+			dst:  "a\nb\nc\n",
+			want: []int{0, 1, 2},
+		},
+		{
+			name: "replaced lines are unmatched",
+			src:  "a\ncall(first, second)\nc\n",
+			dst:  "a\ncall(first,\n\tsecond)\nc\n",
+			want: []int{0, -1, -1, 2},
+		},
+		{
+			name:          "split line",
+			src:           "a\ncall(first, second)\nc\n",
+			dst:           "a\ncall(first,\n\tsecond)\nc\n",
+			matchReplaced: true,
+			want:          []int{0, 1, 1, 2},
+		},
+		{
+			// An ignored reformat turning one line into two, one of
+			// them new, keeps the new line on the reformat
+			name:          "line added in a replacement",
+			src:           "a\ncall(first, second)\nc\n",
+			dst:           "a\n// TODO\ncall(first,  second)\nc\n",
+			matchReplaced: true,
+			want:          []int{0, -1, 1, 2},
+		},
+		{
+			name:          "pure insertion",
+			src:           "a\nc\n",
+			dst:           "a\nb\nc\n",
+			matchReplaced: true,
+			want:          []int{0, -1, 1},
+		},
+	}
+	for _, tt := range tests {
+		if got := diffLineMap(tt.src, tt.dst, tt.matchReplaced); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: diffLineMap = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
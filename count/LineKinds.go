@@ -0,0 +1,183 @@
+/*
+count/LineKinds.go
+
+Splits the lines of a file into code, comment and blank lines using
+the syntax of its language from count/Syntax.go. Lines are scanned in
+order while tracking open block comments and string literals, so
+comment markers inside strings are ignored and nested block comments
+are only closed by their matching end. A line holding both code and a
+comment counts as code, and a line holding only whitespace is blank
+unless it is part of a multi-line string literal.
+*/
+
+package count
+
+import "bytes"
+
+// Classification of a single line
+type lineKind uint8
+
+const (
+	lineCode lineKind = iota
+	lineComment
+	lineBlank
+	numLineKinds
+)
+
+// Open block comment or string literal carried over between lines
+type lineState struct {
+	block *blockComment
+	// Nesting depth of the open block comment, 0 outside comments
+	depth int
+	str   *stringLiteral
+}
+
+// classifyLines returns the kind of every line in content. As with git,
+// a final line without a trailing newline still counts as a line.
+func classifyLines(filetype string, content []byte) []lineKind {
+	syntax := languageSyntaxes[filetype]
+
+	var kinds []lineKind
+	var state lineState
+	for len(content) > 0 {
+		line := content
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			line, content = content[:i], content[i+1:]
+		} else {
+			content = nil
+		}
+		kinds = append(kinds, syntax.classifyLine(line, &state))
+	}
+	return kinds
+}
+
+// countLineKinds returns the number of lines of each kind in the n
+// lines of kinds starting at start. Lines past the end of kinds, for
+// example when a blame disagrees with the content, count as code.
+func countLineKinds(kinds []lineKind, start, n int) [numLineKinds]int {
+	var counts [numLineKinds]int
+	for i := start; i < start+n; i++ {
+		if i < len(kinds) {
+			counts[kinds[i]]++
+		} else {
+			counts[lineCode]++
+		}
+	}
+	return counts
+}
+
+// classifyLine classifies a single line without its newline, updating
+// state with the comments and strings left open at its end.
+func (s languageSyntax) classifyLine(line []byte, state *lineState) lineKind {
+	inString := state.str != nil
+	code, comment := false, false
+
+	for i := 0; i < len(line); {
+		switch {
+		case state.str != nil:
+			code = true
+			str := state.str
+			if !str.raw && line[i] == '\\' {
+				i += 2
+				continue
+			}
+			if bytes.HasPrefix(line[i:], []byte(str.delim)) {
+				state.str = nil
+				i += len(str.delim)
+				continue
+			}
+			i++
+
+		case state.depth > 0:
+			block := state.block
+			if bytes.HasPrefix(line[i:], []byte(block.end)) {
+				comment = true
+				state.depth--
+				if state.depth == 0 {
+					state.block = nil
+				}
+				i += len(block.end)
+				continue
+			}
+			if block.nested && bytes.HasPrefix(line[i:], []byte(block.start)) {
+				comment = true
+				state.depth++
+				i += len(block.start)
+				continue
+			}
+			if !isLineSpace(line[i]) {
+				comment = true
+			}
+			i++
+
+		case isLineSpace(line[i]):
+			i++
+
+		default:
+			// Block comments first, their start may begin with a line comment marker
+			if block := s.blockCommentAt(line[i:]); block != nil {
+				comment = true
+				state.block = block
+				state.depth = 1
+				i += len(block.start)
+				continue
+			}
+			if s.lineCommentAt(line[i:]) {
+				comment = true
+				i = len(line)
+				continue
+			}
+			code = true
+			if str := s.stringAt(line[i:]); str != nil {
+				state.str = str
+				i += len(str.delim)
+				continue
+			}
+			i++
+		}
+	}
+
+	// Single line strings don't carry over to the next line
+	if state.str != nil && !state.str.multiline {
+		state.str = nil
+	}
+
+	switch {
+	case code || inString:
+		return lineCode
+	case comment:
+		return lineComment
+	}
+	return lineBlank
+}
+
+func (s languageSyntax) blockCommentAt(b []byte) *blockComment {
+	for i := range s.blockComments {
+		if bytes.HasPrefix(b, []byte(s.blockComments[i].start)) {
+			return &s.blockComments[i]
+		}
+	}
+	return nil
+}
+
+func (s languageSyntax) lineCommentAt(b []byte) bool {
+	for _, marker := range s.lineComments {
+		if bytes.HasPrefix(b, []byte(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s languageSyntax) stringAt(b []byte) *stringLiteral {
+	for i := range s.strings {
+		if bytes.HasPrefix(b, []byte(s.strings[i].delim)) {
+			return &s.strings[i]
+		}
+	}
+	return nil
+}
+
+func isLineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v'
+}
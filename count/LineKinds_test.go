@@ -0,0 +1,121 @@
+package count
+
+import (
+	"strings"
+	"testing"
+)
+
+// kindString returns the kinds of the lines of src as one letter each:
+// c for code, m for comment and b for blank.
+func kindString(filetype, src string) string {
+	var b strings.Builder
+	for _, kind := range classifyLines(filetype, []byte(src)) {
+		b.WriteByte("cmb"[kind])
+	}
+	return b.String()
+}
+
+type lineKindTest struct {
+	name string
+	src  string
+	want string
+}
+
+func runLineKindTests(t *testing.T, filetype string, tests []lineKindTest) {
+	t.Helper()
+	for _, tt := range tests {
+		if got := kindString(filetype, tt.src); got != tt.want {
+			t.Errorf("%s %s: kinds = %q, want %q", filetype, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyCLike(t *testing.T) {
+	runLineKindTests(t, "C", []lineKindTest{
+		{"line comment", "// comment\nint x; // trailing\n", "mc"},
+		{"blank lines", "\n   \n\t\n", "bbb"},
+		{"block comment", "/* start\n   middle\n\n end */\nint y;\n", "mmbmc"},
+		{"code after block comment", "/* a */ int y;\n/* one line */\n", "cm"},
+		{"comment marker in string", "char *s = \"// not\";\nchar *t = \"/* not\";\nx;\n", "ccc"},
+		{"escaped quote", "s = \"a \\\" // b\";\n// c\n", "cm"},
+		{"char literal", "c = '\"';\n// c\n", "cm"},
+		{"unterminated string ends with the line", "s = \"open\n// comment\n", "cm"},
+		{"string marker in comment", "/* \"open\n*/\n", "mm"},
+		{"block comments don't nest", "/* a /* b */\nx */\n", "mc"},
+	})
+	runLineKindTests(t, "Go", []lineKindTest{
+		{"raw string", "s := `\n// inside\n\n`\n// outside\n", "ccccm"},
+		{"backslash in raw string", "s := `a\\`\n// comment\n", "cm"},
+	})
+	runLineKindTests(t, "JavaScript", []lineKindTest{
+		{"template literal", "s = `a \\` b\n// inside`\n// outside\n", "ccm"},
+	})
+}
+
+func TestClassifyHash(t *testing.T) {
+	runLineKindTests(t, "Ruby", []lineKindTest{
+		{"line comment", "# comment\nx = 1  # trailing\n", "mc"},
+		{"comment marker in string", "s = \"# not\"\nt = '# not'\n", "cc"},
+		{"block comment", "=begin\ndocs\n=end\nx = 1\n", "mmmc"},
+	})
+	runLineKindTests(t, "Shell", []lineKindTest{
+		{"backslash in single quotes", "echo 'a\\'\n# comment\n", "cm"},
+		{"escaped double quote", "echo \"a\\\" # b\"\n# comment\n", "cm"},
+	})
+}
+
+func TestClassifyNested(t *testing.T) {
+	runLineKindTests(t, "Rust", []lineKindTest{
+		{"nested on one line", "/* outer /* inner */ still */\nlet x = 1;\n", "mc"},
+		{"nested across lines", "/* a /* b */\nstill */\nlet x = 1;\n", "mmc"},
+		{"end marker in string", "let s = \"*/\"; /* c */\n", "c"},
+	})
+	runLineKindTests(t, "D", []lineKindTest{
+		{"nested plus comment", "/+ /+ inner +/ +/ int x;\n/+ a /+ b +/\n+/\n", "cmm"},
+		{"block comment beside nested one", "/* a /+ b */\nint x;\n", "mc"},
+	})
+}
+
+func TestClassifyMLHaskell(t *testing.T) {
+	runLineKindTests(t, "OCaml", []lineKindTest{
+		{"nested block comment", "(* outer (* inner *) still *)\nlet x = 1\n", "mc"},
+		{"nested across lines", "(* a (* b *)\nc *)\nlet y = 2\n", "mmc"},
+		{"comment marker in string", "let s = \"(*\" in s\nlet t = 1\n", "cc"},
+	})
+	runLineKindTests(t, "Haskell", []lineKindTest{
+		{"line comment", "-- comment\nx = 1 -- trailing\n", "mc"},
+		{"nested block comment", "{- a {- b -}\nc -}\nmain = pure ()\n", "mmc"},
+		{"comment marker in string", "s = \"--\"\nt = \"{-\"\nu = 1\n", "ccc"},
+	})
+}
+
+func TestClassifyPythonTripleQuote(t *testing.T) {
+	runLineKindTests(t, "Python", []lineKindTest{
+		{"docstring", "\"\"\"\nDocs # not a comment\n\n\"\"\"\n# comment\n", "ccccm"},
+		{"single quoted triple", "s = '''\n# inside\n'''\n# outside\n", "cccm"},
+		{"triple quotes in a string", "s = '\"\"\"'\n# comment\n", "cm"},
+		{"one line docstring", "\"\"\"Docs.\"\"\"\nx = 1\n", "cc"},
+		{"escaped quote in triple quotes", "s = \"\"\"a \\\"\"\"\n# inside\n\"\"\"\n# outside\n", "cccm"},
+	})
+}
+
+func TestCountFileFinalNewline(t *testing.T) {
+	tests := []struct {
+		src                       string
+		count, code, comment, bln int
+	}{
+		{"", 0, 0, 0, 0},
+		{"\n", 1, 0, 0, 1},
+		{"x := 1", 1, 1, 0, 0},
+		{"x := 1\n", 1, 1, 0, 0},
+		{"x := 1\n// done", 2, 1, 1, 0},
+		{"x := 1\n\n", 2, 1, 0, 1},
+		{"x := 1\n  ", 2, 1, 0, 1},
+	}
+	for _, tt := range tests {
+		c := countFile("main.go", []byte(tt.src), "Go")
+		if c.Count != tt.count || c.Code != tt.code || c.Comment != tt.comment || c.Blank != tt.bln {
+			t.Errorf("countFile(%q) = %+v, want %d lines, %d code, %d comment, %d blank", tt.src, c, tt.count, tt.code, tt.comment, tt.bln)
+		}
+	}
+}
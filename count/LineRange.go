@@ -0,0 +1,70 @@
+/*
+count/LineRange.go
+
+Line level blame data. Instead of only tallying blamed lines by author,
+a scanner can hand every blame hunk to a callback as the workers
+produce it, as a range of lines with the commit that last changed
+them. Ranges are reported for every blamed line, regardless of the
+date range and author grouping.
+*/
+
+package count
+
+import "time"
+
+// A run of consecutive lines of a counted file last changed by the
+// same commit
+type LineRange struct {
+	// Slash separated path of the file within its repository, so
+	// ranges from a scanned subdirectory or submodule can be joined
+	// with git's own output
+	Path     string
+	Language string
+	// First and last line of the range, counting from 1
+	StartLine int
+	EndLine   int
+
+	Commit      string
+	AuthorName  string
+	AuthorEmail string
+	AuthorTime  time.Time
+	CommitTime  time.Time
+	// The commit has no parents, so lines were not traced further back
+	Boundary bool
+}
+
+// Receives the line ranges of each blamed file. It is called from
+// several blame workers at once, so it must be safe for concurrent use.
+type LineRangeFunc func(LineRange)
+
+// OnLineRange sets the callback the scanner's blame workers pass every
+// line range to, nil to stop reporting them. Submodules scanned in
+// recurse mode report their ranges to the same callback.
+func (s *Scanner) OnLineRange(fn LineRangeFunc) {
+	s.onLineRange = fn
+}
+
+// reportLineRanges passes the hunks of a blamed file, whose path within
+// the repository is localizedPath, to the scanner's line range
+// callback, if one is set.
+func (s *Scanner) reportLineRanges(file ValidFile, localizedPath string, hunks []BlameHunk) {
+	if s.onLineRange == nil {
+		return
+	}
+	line := 1
+	for _, hunk := range hunks {
+		s.onLineRange(LineRange{
+			Path:        localizedPath,
+			Language:    file.Filetype,
+			StartLine:   line,
+			EndLine:     line + hunk.Lines - 1,
+			Commit:      hunk.Hash,
+			AuthorName:  hunk.Name,
+			AuthorEmail: hunk.Email,
+			AuthorTime:  hunk.When,
+			CommitTime:  hunk.CommitterWhen,
+			Boundary:    hunk.Boundary,
+		})
+		line += hunk.Lines
+	}
+}
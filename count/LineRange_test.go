@@ -0,0 +1,43 @@
+package count
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestLineRangePaths checks that the ranges of a scanned subdirectory
+// carry paths within the repository, and cover every line in order.
+func TestLineRangePaths(t *testing.T) {
+	repo, _ := newBlameFixture(t)
+
+	var mu sync.Mutex
+	var ranges []LineRange
+	scanner := NewScanner(filepath.Join(repo, "docs"), IgnoreConfig{}, Options{NoCache: true})
+	scanner.OnLineRange(func(lr LineRange) {
+		mu.Lock()
+		defer mu.Unlock()
+		ranges = append(ranges, lr)
+	})
+	if _, err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ranges) == 0 {
+		t.Fatal("no line ranges reported")
+	}
+	next := 1
+	for _, lr := range ranges {
+		if lr.Path != "docs/my notes.txt" {
+			t.Errorf("range path %q, want %q", lr.Path, "docs/my notes.txt")
+		}
+		if lr.StartLine != next || lr.EndLine < lr.StartLine {
+			t.Errorf("range %d-%d, want one starting at %d", lr.StartLine, lr.EndLine, next)
+		}
+		next = lr.EndLine + 1
+	}
+	if next != 5 {
+		t.Errorf("ranges end at line %d, want 4", next-1)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+count/Mailmap.go
+
+Parsing and lookup of git .mailmap files, used to canonicalize
+author identities before blame results are aggregated. Supports
+all four forms documented in gitmailmap(5).
+*/
+
+package count
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// How blamed lines are grouped into authors
+type GroupBy string
+
+const (
+	// Group by the author name recorded in each commit
+	GroupByName GroupBy = "name"
+	// Group by the author email recorded in each commit
+	GroupByEmail GroupBy = "email"
+	// Group by the author name after applying the mailmap
+	GroupByMailmap GroupBy = "mailmap"
+)
+
+// ParseGroupBy validates a --group-by value.
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch g := GroupBy(s); g {
+	case GroupByName, GroupByEmail, GroupByMailmap:
+		return g, nil
+	}
+	return "", fmt.Errorf("invalid group-by %q, expected name, email or mailmap", s)
+}
+
+// Next returns the grouping that follows g, cycling back to the start.
+func (g GroupBy) Next() GroupBy {
+	switch g {
+	case GroupByName:
+		return GroupByEmail
+	case GroupByEmail:
+		return GroupByMailmap
+	}
+	return GroupByName
+}
+
+// Canonical identity for an author
+type mailmapEntry struct {
+	name  string
+	email string
+}
+
+// Mapping from commit identities to canonical identities. Entries are
+// keyed by lowercased commit email and, optionally, commit name.
+type Mailmap struct {
+	entries map[string]mailmapEntry
+}
+
+func NewMailmap() *Mailmap {
+	return &Mailmap{entries: make(map[string]mailmapEntry)}
+}
+
+func mailmapKey(name, email string) string {
+	return strings.ToLower(email) + "\x00" + strings.ToLower(name)
+}
+
+// Parse reads mailmap entries from r. Entries read later take
+// precedence over earlier ones for the same commit identity.
+func (m *Mailmap) Parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		// Split the line into "name <email>" pairs
+		var names, emails []string
+		for {
+			open := strings.Index(line, "<")
+			if open == -1 {
+				break
+			}
+			end := strings.Index(line[open:], ">")
+			if end == -1 {
+				break
+			}
+			names = append(names, strings.TrimSpace(line[:open]))
+			emails = append(emails, strings.TrimSpace(line[open+1:open+end]))
+			line = line[open+end+1:]
+		}
+
+		switch len(emails) {
+		case 1:
+			// Proper Name <commit@email>
+			if names[0] == "" {
+				continue
+			}
+			m.add("", emails[0], mailmapEntry{name: names[0]})
+		case 2:
+			// [Proper Name] <proper@email> [Commit Name] <commit@email>
+			m.add(names[1], emails[1], mailmapEntry{name: names[0], email: emails[0]})
+		}
+	}
+	return scanner.Err()
+}
+
+func (m *Mailmap) add(commitName, commitEmail string, entry mailmapEntry) {
+	key := mailmapKey(commitName, commitEmail)
+	existing := m.entries[key]
+	if entry.name == "" {
+		entry.name = existing.name
+	}
+	if entry.email == "" {
+		entry.email = existing.email
+	}
+	m.entries[key] = entry
+}
+
+// merge adds the entries of other, which take precedence over the
+// existing ones for the same commit identity.
+func (m *Mailmap) merge(other *Mailmap) {
+	if other == nil {
+		return
+	}
+	for key, entry := range other.entries {
+		m.entries[key] = entry
+	}
+}
+
+// Lookup returns the canonical name and email for a commit identity.
+// Entries matching both name and email win over email-only entries.
+// Unmapped fields are returned unchanged.
+func (m *Mailmap) Lookup(name, email string) (string, string) {
+	if m == nil {
+		return name, email
+	}
+	entry, ok := m.entries[mailmapKey(name, email)]
+	if !ok {
+		entry, ok = m.entries[mailmapKey("", email)]
+	}
+	if !ok {
+		return name, email
+	}
+	if entry.name != "" {
+		name = entry.name
+	}
+	if entry.email != "" {
+		email = entry.email
+	}
+	return name, email
+}
+
+// LoadMailmap reads the repository's .mailmap from the working tree at
+// root, falling back to the one in commit's tree, then layers the
+// override file on top if one is given.
+func LoadMailmap(root string, commit *object.Commit, override string) (*Mailmap, error) {
+	m := NewMailmap()
+
+	f, err := openWorktreeFile(root, ".mailmap")
+	switch {
+	case err == nil:
+		defer f.Close()
+		if err := m.Parse(f); err != nil {
+			return nil, err
+		}
+	case os.IsNotExist(err) && commit != nil:
+		if file, err := commit.File(".mailmap"); err == nil {
+			reader, err := file.Reader()
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			if err := m.Parse(reader); err != nil {
+				return nil, err
+			}
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if override != "" {
+		of, err := os.Open(override)
+		if err != nil {
+			return nil, err
+		}
+		defer of.Close()
+		if err := m.Parse(of); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,140 @@
+package count
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseMailmap(t *testing.T, content string) *Mailmap {
+	t.Helper()
+	m := NewMailmap()
+	if err := m.Parse(strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+type mailmapLookup struct {
+	name, email         string
+	wantName, wantEmail string
+}
+
+func checkLookups(t *testing.T, m *Mailmap, tests []mailmapLookup) {
+	t.Helper()
+	for _, tt := range tests {
+		name, email := m.Lookup(tt.name, tt.email)
+		if name != tt.wantName || email != tt.wantEmail {
+			t.Errorf("Lookup(%q, %q) = %q, %q, want %q, %q", tt.name, tt.email, name, email, tt.wantName, tt.wantEmail)
+		}
+	}
+}
+
+func TestMailmapForms(t *testing.T) {
+	m := parseMailmap(t, `# comment
+Proper Name <name@example.com>
+<proper@example.com> <email@example.com>
+Both Proper <both@example.com> <both-old@example.com>
+Pair Proper <pair@example.com> Pair Commit <pair-old@example.com>
+  Trailing <trailing@example.com>   # comment
+<no-name@example.com>
+not a mailmap line
+`)
+	checkLookups(t, m, []mailmapLookup{
+		// Proper Name <commit@email>
+		{"Old Name", "name@example.com", "Proper Name", "name@example.com"},
+		// <proper@email> <commit@email>
+		{"Someone", "email@example.com", "Someone", "proper@example.com"},
+		// Proper Name <proper@email> <commit@email>
+		{"Old", "both-old@example.com", "Both Proper", "both@example.com"},
+		// Proper Name <proper@email> Commit Name <commit@email>
+		{"Pair Commit", "pair-old@example.com", "Pair Proper", "pair@example.com"},
+		{"Someone Else", "pair-old@example.com", "Someone Else", "pair-old@example.com"},
+		{"Old", "trailing@example.com", "Trailing", "trailing@example.com"},
+		{"Kept", "no-name@example.com", "Kept", "no-name@example.com"},
+		{"Unmapped", "unmapped@example.com", "Unmapped", "unmapped@example.com"},
+	})
+}
+
+func TestMailmapCaseInsensitive(t *testing.T) {
+	m := parseMailmap(t, "Proper <proper@example.com> Commit Name <Commit@Example.com>\nOther <OTHER@example.com>\n")
+	checkLookups(t, m, []mailmapLookup{
+		{"commit name", "COMMIT@example.COM", "Proper", "proper@example.com"},
+		{"Someone", "other@EXAMPLE.com", "Other", "other@EXAMPLE.com"},
+	})
+}
+
+func TestMailmapPrecedence(t *testing.T) {
+	m := parseMailmap(t, `Pair Proper <pair@example.com> Pair Commit <shared@example.com>
+Email Proper <email@example.com> <shared@example.com>
+Named <combined@example.com>
+<proper@example.com> <combined@example.com>
+First <twice@example.com>
+Second <twice@example.com>
+`)
+	checkLookups(t, m, []mailmapLookup{
+		// Entries matching the name and email win over email-only ones
+		{"Pair Commit", "shared@example.com", "Pair Proper", "pair@example.com"},
+		{"Anyone", "shared@example.com", "Email Proper", "email@example.com"},
+		// Entries for the same identity fill in each other's fields
+		{"Old", "combined@example.com", "Named", "proper@example.com"},
+		// Later entries replace earlier ones
+		{"Old", "twice@example.com", "Second", "twice@example.com"},
+	})
+}
+
+func TestLoadMailmapOverride(t *testing.T) {
+	root := t.TempDir()
+	writeFixtureFile(t, filepath.Join(root, ".mailmap"), "Repo Name <a@example.com>\nRepo Only <b@example.com>\n")
+	override := filepath.Join(t.TempDir(), "mailmap")
+	writeFixtureFile(t, override, "Override Name <a@example.com>\nOverride Only <c@example.com>\n")
+
+	m, err := LoadMailmap(root, nil, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLookups(t, m, []mailmapLookup{
+		{"A", "a@example.com", "Override Name", "a@example.com"},
+		{"B", "b@example.com", "Repo Only", "b@example.com"},
+		{"C", "c@example.com", "Override Only", "c@example.com"},
+	})
+
+	// Without a .mailmap, the override still applies
+	m, err = LoadMailmap(t.TempDir(), nil, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLookups(t, m, []mailmapLookup{
+		{"A", "a@example.com", "Override Name", "a@example.com"},
+		{"B", "b@example.com", "B", "b@example.com"},
+	})
+
+	if _, err := LoadMailmap(root, nil, filepath.Join(root, "missing")); err == nil {
+		t.Error("LoadMailmap with a missing override file succeeded")
+	}
+}
+
+// TestLoadMailmapFromCommit checks that the .mailmap of the commit's
+// tree is read when there is no work tree.
+func TestLoadMailmapFromCommit(t *testing.T) {
+	requireGit(t)
+	repo, _ := newBlameFixture(t)
+	writeFixtureFile(t, filepath.Join(repo, ".mailmap"), "Committed <a@example.com>\n")
+	gitCommit(t, repo, "Alice", 10)
+
+	r, _, _, err := OpenRepo(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := ResolveCommit(r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadMailmap("", commit, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLookups(t, m, []mailmapLookup{
+		{"A", "a@example.com", "Committed", "a@example.com"},
+	})
+}
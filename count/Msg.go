@@ -6,10 +6,22 @@ Bubble Tea message types used in the count package.
 package count
 
 type WalkDoneMsg struct {
+	Result                 *Result
 	Counts                 map[string]FileCount
 	SortedAlphabeticalKeys []string
 	SortedCountsKeys       []string
 	TotalLines             int
+	// Line counts summed over every filetype
+	Totals FileCount
+	Tree   *DirNode
+	// Entries that couldn't be counted
+	Skipped []SkippedEntry
+	// Files and directories that couldn't be read
+	Errors []FileError
+	// Submodules counted on their own in recurse mode
+	Submodules []*SubmoduleResult
+	// The walk timed out before every file was counted
+	Incomplete bool
 }
 
 type WalkErrorMsg struct {
@@ -19,6 +31,20 @@ type WalkErrorMsg struct {
 type BlameDoneMsg struct {
 	Counts     map[string]*BlameCount
 	SortedKeys []string
+	// Lines changed before or after DateRange, nil if that side is open
+	Older     *BlameCount
+	Newer     *BlameCount
+	DateRange DateRange
+	GroupBy   GroupBy
+	// Directory tree with the blame counts by author
+	Tree *DirNode
+	// Files that couldn't be blamed and the share of lines that were
+	Failures []BlameFailure
+	Coverage float64
+	// Submodules blamed on their own in recurse mode
+	Submodules []*SubmoduleResult
+	// The scan timed out before every file was counted and blamed
+	Incomplete bool
 }
 
 type BlameErrorMsg struct {
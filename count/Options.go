@@ -0,0 +1,70 @@
+/*
+count/Options.go
+
+Options that control how the repository is walked and blamed,
+separate from the filetype exclusions in IgnoreConfig.
+*/
+
+package count
+
+import (
+	"context"
+	"time"
+)
+
+type Options struct {
+	// Enumerate files from the git index instead of the filesystem,
+	// so only tracked files are counted and blamed
+	TrackedOnly bool
+	// Walk into symlinked directories and count symlinked files,
+	// instead of skipping symlinks
+	FollowSymlinks bool
+	// Count and blame the tree of this commit-ish instead of the
+	// working directory and HEAD
+	Rev string
+	// Only attribute lines last changed within this range to their authors
+	DateRange DateRange
+	// How author identities are grouped, through the mailmap if unset
+	GroupBy GroupBy
+	// Mailmap file layered on top of the repository's .mailmap
+	Mailmap string
+	// Revisions to look past during blame, in addition to the
+	// ones listed in .git-blame-ignore-revs
+	IgnoreRevs []string
+	// Blame every file instead of using the on-disk blame cache
+	NoCache bool
+	// Attribution backend, auto picks git when it is on PATH
+	Backend BackendKind
+	// Stop the scan after this long and keep the partial results,
+	// zero for no limit
+	Timeout time.Duration
+	// Number of files walked and blamed in parallel, zero picks a
+	// default based on the number of CPUs
+	Jobs int
+	// Stop at the first file or directory that can't be read,
+	// instead of recording it and carrying on
+	Strict bool
+	// Whether submodules are skipped, counted with the superproject
+	// or scanned on their own, counted with it if unset
+	Submodules SubmoduleMode
+}
+
+// Context derives the context a scan runs under from parent, applying
+// the timeout if one is set.
+func (o Options) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout > 0 {
+		return context.WithTimeout(parent, o.Timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// jobs returns the number of workers to use, or fallback if unset.
+func (o Options) jobs(fallback int) int {
+	if o.Jobs > 0 {
+		return o.Jobs
+	}
+	if fallback < 1 {
+		return 1
+	}
+	return fallback
+}
@@ -0,0 +1,130 @@
+/*
+count/Repo.go
+
+Helpers for opening the repository being analyzed and resolving
+the revision that counting and blame operate on.
+*/
+
+package count
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// OpenRepo opens the repository containing dir, which may be the root
+// of its work tree or any directory below it. Linked worktrees, whose
+// .git file points into the main repository, share its objects and
+// refs. It also returns the work tree root and dir's slash separated
+// path relative to it, "" if dir is the root. A bare repository has
+// no work tree, so dir must be the repository itself and is its root.
+func OpenRepo(dir string) (repo *git.Repository, root, prefix string, err error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Open dir itself first, so a bare repository nested in another
+	// repository's work tree isn't mistaken for a directory of it
+	repo, err = git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repo, err = git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{
+			DetectDotGit:          true,
+			EnableDotGitCommonDir: true,
+		})
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	worktree, err := repo.Worktree()
+	if errors.Is(err, git.ErrIsBareRepository) {
+		return repo, absDir, "", nil
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	root = worktree.Filesystem.Root()
+	return repo, root, relativeSlashPath(root, absDir), nil
+}
+
+// isBare reports whether repo is bare, with no working directory to
+// count files from.
+func isBare(repo *git.Repository) bool {
+	_, err := repo.Worktree()
+	return errors.Is(err, git.ErrIsBareRepository)
+}
+
+// openWorktreeFile opens the file called name at the root of a work
+// tree. Repositories that aren't on disk have the root "", and every
+// file is reported as missing.
+func openWorktreeFile(root, name string) (*os.File, error) {
+	if root == "" {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(filepath.Join(root, name))
+}
+
+// repoPath returns the slash separated path within the repository of
+// the file at filePath, found below the scanned directory root whose
+// path within the repository is prefix.
+func repoPath(root, prefix, filePath string) string {
+	return path.Join(prefix, relativeSlashPath(root, filePath))
+}
+
+// ResolveCommit returns the commit for rev (a branch, tag, SHA or other
+// commit-ish). An empty rev resolves to HEAD.
+func ResolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	if rev == "" {
+		headRef, err := repo.Head()
+		if err != nil {
+			return nil, err
+		}
+		return repo.CommitObject(headRef.Hash())
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	return repo.CommitObject(*hash)
+}
+
+// repoCommonDir returns the git directory shared by every worktree of
+// the repository, holding its config, info/exclude and info/attributes.
+// That is the git directory itself unless repo is a linked worktree.
+// Submodules have a .git file pointing elsewhere, so neither is always
+// root/.git.
+func repoCommonDir(repo *git.Repository) string {
+	gitDir := repoGitDir(repo)
+	if gitDir == "" {
+		return ""
+	}
+	content, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	common := strings.TrimSpace(string(content))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(gitDir, common)
+	}
+	return filepath.Clean(common)
+}
+
+// repoGitDir returns the path of the repository's git directory, or ""
+// if the repository isn't stored on disk.
+func repoGitDir(repo *git.Repository) string {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return ""
+	}
+	return storage.Filesystem().Root()
+}
@@ -0,0 +1,166 @@
+/*
+count/Scanner.go
+
+Scanner drives a single count and blame run over a repository and
+returns its Result. Scanners hold no shared state, so several can run
+in one process and a scanner can be reused for repeated runs. This is
+the entry point for the TUI, JsonExport and library users alike.
+*/
+
+package count
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-git/go-git/v5"
+)
+
+type Scanner struct {
+	root    string
+	ignore  IgnoreConfig
+	options Options
+	// Repository that isn't on disk, such as an in-memory clone, or
+	// nil to open the one containing root
+	repo *git.Repository
+	// Receives the line ranges of every blamed file, see OnLineRange
+	onLineRange LineRangeFunc
+
+	// Channel for sending status messages to the TUI
+	status chan tea.Msg
+}
+
+// Data collected by a single scan
+type Result struct {
+	// Line counts by filetype
+	Counts                 map[string]FileCount
+	SortedAlphabeticalKeys []string
+	SortedCountsKeys       []string
+	Files                  []ValidFile
+	TotalLines             int
+	// Line counts summed over every filetype
+	Totals FileCount
+	// Line and blame counts by directory
+	Tree *DirNode
+	// Entries found by the walk that couldn't be counted, by path
+	Skipped []SkippedEntry
+	// Files and directories that couldn't be read, by path
+	Errors []FileError
+	// Submodules counted and blamed on their own in recurse mode,
+	// whose files aren't included in the counts above
+	Submodules []*SubmoduleResult
+
+	// Blame counts by author, as aggregated by the last TallyBlame
+	BlameCounts     map[string]*BlameCount
+	SortedBlameKeys []string
+	// Lines changed outside the date range, nil if that side is open
+	BlameOlder *BlameCount
+	BlameNewer *BlameCount
+	DateRange  DateRange
+	GroupBy    GroupBy
+	// Counted files that couldn't be blamed, by path
+	BlameFailures []BlameFailure
+	// Lines attributed by blame, regardless of date range
+	BlamedLines int
+
+	// The scan was cancelled or timed out before it finished, so
+	// only some of the files are counted or blamed
+	Incomplete bool
+
+	// Raw tallies recorded by the blame workers, kept so the date
+	// range and grouping can be changed without blaming again
+	tallies map[blameTally]int
+	mailmap *Mailmap
+	// Directory the files were found in
+	root   string
+	locker sync.Mutex
+}
+
+// NewScanner creates a scanner for the directory at root.
+func NewScanner(root string, ignore IgnoreConfig, opts Options) *Scanner {
+	return &Scanner{
+		root:    root,
+		ignore:  ignore,
+		options: opts,
+		status:  make(chan tea.Msg),
+	}
+}
+
+func newResult(root string) *Result {
+	return &Result{
+		root:        root,
+		Counts:      make(map[string]FileCount),
+		Files:       make([]ValidFile, 0),
+		Totals:      FileCount{Filetype: "Total"},
+		BlameCounts: make(map[string]*BlameCount),
+		tallies:     make(map[blameTally]int),
+	}
+}
+
+// Root returns the directory the scanner was created for.
+func (s *Scanner) Root() string {
+	return s.root
+}
+
+// With returns a new scanner for the same directory or repository with
+// different exclusions and options.
+func (s *Scanner) With(ignore IgnoreConfig, opts Options) *Scanner {
+	scanner := NewScanner(s.root, ignore, opts)
+	scanner.repo = s.repo
+	scanner.onLineRange = s.onLineRange
+	return scanner
+}
+
+// openRepo opens a new handle on the scanned repository, see OpenRepo.
+// A handle isn't safe for concurrent use, so goroutines each open their
+// own. Handles on a repository that isn't on disk share its storage,
+// which is only read, and have no work tree, so their root is "".
+func (s *Scanner) openRepo() (repo *git.Repository, root, prefix string, err error) {
+	if s.repo != nil {
+		repo, err = git.Open(s.repo.Storer, nil)
+		return repo, "", "", err
+	}
+	return OpenRepo(s.root)
+}
+
+// Status returns the channel status messages are sent on while
+// blaming. Sends never block, so it is fine to not read from it.
+func (s *Scanner) Status() <-chan tea.Msg {
+	return s.status
+}
+
+// Scan walks the directory and blames the files found. If the
+// directory isn't a git repository the result has no blame counts.
+// If ctx is done first, the partial result is returned along with
+// the context's error.
+func (s *Scanner) Scan(ctx context.Context) (*Result, error) {
+	res, err := s.Walk(ctx)
+	if err != nil {
+		return res, err
+	}
+	if err := s.Blame(ctx, res); err != nil && !errors.Is(err, git.ErrRepositoryNotExists) {
+		return res, err
+	}
+	return res, nil
+}
+
+// sortCounts creates the alphabetical and count sorted filetype keys.
+func (r *Result) sortCounts() {
+	var FileTypeKeys []string
+	for k := range r.Counts {
+		FileTypeKeys = append(FileTypeKeys, k)
+	}
+	sort.Strings(FileTypeKeys)
+
+	SortedCountsKeys := make([]string, len(FileTypeKeys))
+	copy(SortedCountsKeys, FileTypeKeys)
+	sort.Slice(SortedCountsKeys, func(i, j int) bool {
+		return r.Counts[SortedCountsKeys[i]].Count > r.Counts[SortedCountsKeys[j]].Count
+	})
+
+	r.SortedAlphabeticalKeys = FileTypeKeys
+	r.SortedCountsKeys = SortedCountsKeys
+}
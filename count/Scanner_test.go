@@ -0,0 +1,119 @@
+package count
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newScanFixture creates a tree of n source files spread over nested
+// directories, committed to a repository if git is available.
+func newScanFixture(tb testing.TB, n int) string {
+	tb.Helper()
+	dir := tb.TempDir()
+	tb.Setenv("HOME", filepath.Join(dir, "home"))
+	tb.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "home", ".config"))
+	tb.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	repo := filepath.Join(dir, "repo")
+
+	exts := []string{"go", "py", "js", "md"}
+	for i := 0; i < n; i++ {
+		var b strings.Builder
+		for l := 0; l < 20+i%30; l++ {
+			fmt.Fprintf(&b, "line %d of file %d\n", l, i)
+		}
+		name := fmt.Sprintf("pkg%d/sub%d/file%d.%s", i%7, i%3, i, exts[i%len(exts)])
+		writeFixtureFile(tb, filepath.Join(repo, filepath.FromSlash(name)), b.String())
+	}
+
+	if hasGit() {
+		runGit(tb, dir, nil, "init", "-q", "repo")
+		gitCommit(tb, repo, "Alice", 0)
+	}
+	return repo
+}
+
+// filePaths returns the paths of res.Files in order.
+func filePaths(res *Result) []string {
+	paths := make([]string, len(res.Files))
+	for i, f := range res.Files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+// TestFilesOrderAcrossJobs checks that the order of Result.Files
+// doesn't depend on how many workers walked the tree.
+func TestFilesOrderAcrossJobs(t *testing.T) {
+	repo := newScanFixture(t, 200)
+	revs := []string{""}
+	if hasGit() {
+		revs = append(revs, "HEAD")
+	}
+	for _, rev := range revs {
+		var first []string
+		for _, jobs := range []int{1, 2, 4, 16} {
+			res, err := NewScanner(repo, IgnoreConfig{}, Options{Rev: rev, Jobs: jobs}).Walk(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths := filePaths(res)
+			if len(paths) != 200 {
+				t.Fatalf("rev %q, %d jobs: walked %d files, want 200", rev, jobs, len(paths))
+			}
+			if first == nil {
+				first = paths
+			} else if !reflect.DeepEqual(paths, first) {
+				t.Errorf("rev %q: order of files with %d jobs differs from 1 job", rev, jobs)
+			}
+		}
+	}
+}
+
+// benchmarkJobs returns the worker counts the benchmarks compare, one
+// and one per CPU.
+func benchmarkJobs() []int {
+	if runtime.NumCPU() == 1 {
+		return []int{1}
+	}
+	return []int{1, runtime.NumCPU()}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	repo := newScanFixture(b, 500)
+	for _, jobs := range benchmarkJobs() {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			scanner := NewScanner(repo, IgnoreConfig{}, Options{Jobs: jobs})
+			for i := 0; i < b.N; i++ {
+				if _, err := scanner.Walk(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBlame(b *testing.B) {
+	requireGit(b)
+	repo := newScanFixture(b, 200)
+	for _, jobs := range benchmarkJobs() {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			scanner := NewScanner(repo, IgnoreConfig{}, Options{Jobs: jobs, NoCache: true})
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				res, err := scanner.Walk(context.Background())
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if err := scanner.Blame(context.Background(), res); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
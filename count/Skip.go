@@ -0,0 +1,70 @@
+/*
+count/Skip.go
+
+Entries the walk found but could not count, such as symlinks that
+aren't followed, named pipes, sockets and device files. Reading these
+could block forever or count something outside the tree, so they are
+recorded in the Result with the reason they were skipped instead.
+*/
+
+package count
+
+import (
+	"io/fs"
+	"sort"
+)
+
+// Why an entry wasn't counted
+type SkipReason string
+
+const (
+	SkipSymlink       SkipReason = "symlink"
+	SkipBrokenSymlink SkipReason = "broken symlink"
+	SkipSymlinkCycle  SkipReason = "symlink cycle"
+	SkipNamedPipe     SkipReason = "named pipe"
+	SkipSocket        SkipReason = "socket"
+	SkipDevice        SkipReason = "device"
+	SkipSubmodule     SkipReason = "submodule"
+	SkipIrregular     SkipReason = "irregular file"
+	// A submodule whose repository hasn't been cloned
+	SkipUninitializedSubmodule SkipReason = "uninitialized submodule"
+)
+
+type SkippedEntry struct {
+	Path   string
+	Reason SkipReason
+}
+
+// Records an entry that can't be counted
+type skipFunc func(path string, reason SkipReason)
+
+// skipReasonFor returns why an entry with mode, which isn't a regular
+// file or directory, can't be counted.
+func skipReasonFor(mode fs.FileMode) SkipReason {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return SkipSymlink
+	case mode&fs.ModeNamedPipe != 0:
+		return SkipNamedPipe
+	case mode&fs.ModeSocket != 0:
+		return SkipSocket
+	case mode&fs.ModeDevice != 0:
+		return SkipDevice
+	}
+	return SkipIrregular
+}
+
+// skip records an entry that wasn't counted.
+func (r *Result) skip(path string, reason SkipReason) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.Skipped = append(r.Skipped, SkippedEntry{Path: path, Reason: reason})
+}
+
+// sortSkipped orders the skipped entries by path, as they are recorded
+// both while enumerating and by the pipeline workers.
+func (r *Result) sortSkipped() {
+	sort.Slice(r.Skipped, func(i, j int) bool {
+		return r.Skipped[i].Path < r.Skipped[j].Path
+	})
+}
@@ -0,0 +1,247 @@
+/*
+count/Submodule.go
+
+Git submodule handling. Submodules are found through .gitmodules in
+the working tree and through the gitlinks in the index or tree of a
+revision. Depending on the mode they are skipped, counted along with
+the superproject, or scanned on their own. In recurse mode each
+submodule is counted and blamed against its own repository and
+commit, and its totals are kept in a separate Result.
+*/
+
+package count
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// How submodules are treated by a scan
+type SubmoduleMode string
+
+const (
+	// Leave submodules out, recording them as skipped
+	SubmodulesSkip SubmoduleMode = "skip"
+	// Count submodule files as part of the superproject. They can't
+	// be blamed, as they aren't in the superproject's history
+	SubmodulesCount SubmoduleMode = "count"
+	// Count and blame each submodule on its own
+	SubmodulesRecurse SubmoduleMode = "recurse"
+)
+
+// ParseSubmoduleMode validates a submodule mode given on the command line.
+func ParseSubmoduleMode(s string) (SubmoduleMode, error) {
+	switch m := SubmoduleMode(s); m {
+	case SubmodulesSkip, SubmodulesCount, SubmodulesRecurse:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid submodule mode %q, expected skip, count or recurse", s)
+}
+
+// A submodule scanned on its own in recurse mode
+type SubmoduleResult struct {
+	// Name from .gitmodules, or the path if it isn't listed
+	Name string
+	// Slash separated path relative to the scanned directory
+	Path string
+	// Commit the submodule was counted and blamed at, "" if it has none
+	Commit string
+	Result *Result
+
+	// Scanner that walked the submodule, reused to blame it
+	scanner *Scanner
+}
+
+// A submodule found by the walk, waiting to be scanned in recurse mode
+type foundSubmodule struct {
+	path   string
+	commit plumbing.Hash
+}
+
+// Handles a submodule found by the walk at path, whose commit is
+// recorded by the gitlink in the index or tree. The hash is zero for
+// submodules found in the working tree. walkDir walks into the
+// submodule's directory like any other if it returns true.
+type submoduleFunc func(path string, commit plumbing.Hash) (bool, error)
+
+// loadSubmodules returns the names of the submodules below root listed
+// in the .gitmodules of repo, whose work tree is at repoRoot, keyed by
+// their path on disk. prefix is the path of root within repo, see
+// OpenRepo. The .gitmodules of the commit resolved from rev is used if
+// rev is set. Directories outside of a repository, with a nil repo,
+// have no submodules.
+func loadSubmodules(repo *git.Repository, repoRoot, prefix, root, rev string) (map[string]string, error) {
+	names := make(map[string]string)
+	if repo == nil {
+		return names, nil
+	}
+
+	var content []byte
+	if rev != "" {
+		commit, err := ResolveCommit(repo, rev)
+		if err != nil {
+			return nil, err
+		}
+		file, err := commit.File(".gitmodules")
+		if err != nil {
+			return names, nil
+		}
+		contents, err := file.Contents()
+		if err != nil {
+			return nil, err
+		}
+		content = []byte(contents)
+	} else {
+		f, err := openWorktreeFile(repoRoot, ".gitmodules")
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if content, err = io.ReadAll(f); err != nil {
+			return nil, err
+		}
+	}
+
+	modules := config.NewModules()
+	if err := modules.Unmarshal(content); err != nil {
+		return nil, err
+	}
+	for _, sub := range modules.Submodules {
+		rel := sub.Path
+		if prefix != "" {
+			var ok bool
+			if rel, ok = strings.CutPrefix(rel, prefix+"/"); !ok {
+				continue
+			}
+		}
+		names[filepath.Join(root, filepath.FromSlash(rel))] = sub.Name
+	}
+	return names, nil
+}
+
+// submoduleHandler returns how the walk treats the submodules it finds
+// under the scanner's mode. Submodules counted with the superproject
+// are enumerated with emit, those to recurse into are collected into
+// found.
+func (s *Scanner) submoduleHandler(ctx context.Context, res *Result, emit emitFunc, onError errorFunc, found *[]foundSubmodule) submoduleFunc {
+	var handle submoduleFunc
+	handle = func(path string, commit plumbing.Hash) (bool, error) {
+		// Without a repository of its own, an uninitialized submodule
+		// is an empty directory. Cloned repositories aren't on disk, so
+		// their submodules never are.
+		var subRepo *git.Repository
+		var err error
+		if s.repo == nil {
+			subRepo, err = git.PlainOpen(path)
+		}
+		if s.repo != nil || err != nil {
+			res.skip(path, SkipUninitializedSubmodule)
+			return false, nil
+		}
+
+		switch s.options.Submodules {
+		case SubmodulesCount, "":
+			switch {
+			case s.options.Rev != "":
+				err = walkTree(ctx, subRepo, "", path, commit.String(), emit, res.skip, onError, handle)
+			case s.options.TrackedOnly:
+				err = walkIndex(ctx, path, emit, res.skip, handle)
+			default:
+				return true, nil
+			}
+			// A submodule that can't be enumerated, for example because
+			// the recorded commit wasn't fetched, doesn't stop the walk
+			if err != nil && ctx.Err() == nil {
+				return false, onError(path, PhaseWalk, err)
+			}
+			return false, err
+		case SubmodulesRecurse:
+			*found = append(*found, foundSubmodule{path: path, commit: commit})
+			return false, nil
+		}
+		res.skip(path, SkipSubmodule)
+		return false, nil
+	}
+	return handle
+}
+
+// walkSubmodules counts each submodule found by the walk with a scanner
+// of its own, recording them in res.Submodules. Revisions are resolved
+// to the commits recorded by the superproject. Submodules that can't
+// be walked are passed to onError.
+func (s *Scanner) walkSubmodules(ctx context.Context, res *Result, found []foundSubmodule, names map[string]string, onError errorFunc) error {
+	for _, sub := range found {
+		opts := s.options
+		if opts.Rev != "" {
+			opts.Rev = sub.commit.String()
+		}
+		nested := &Scanner{
+			root:        sub.path,
+			ignore:      s.ignore,
+			options:     opts,
+			status:      s.status,
+			onLineRange: s.onLineRange,
+		}
+
+		subRes, err := nested.Walk(ctx)
+		if err != nil && ctx.Err() == nil {
+			if err := onError(sub.path, PhaseWalk, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if subRes == nil {
+			return err
+		}
+
+		name, ok := names[sub.path]
+		if !ok {
+			name = relativeSlashPath(s.root, sub.path)
+		}
+		var commit string
+		if repo, err := git.PlainOpen(sub.path); err == nil {
+			if c, err := ResolveCommit(repo, opts.Rev); err == nil {
+				commit = c.Hash.String()
+			}
+		}
+		res.Submodules = append(res.Submodules, &SubmoduleResult{
+			Name:    name,
+			Path:    relativeSlashPath(s.root, sub.path),
+			Commit:  commit,
+			Result:  subRes,
+			scanner: nested,
+		})
+
+		// Cancelled while walking the submodule
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blameSubmodules blames each submodule scanned in recurse mode against
+// its own repository. A submodule that can't be blamed at all, such as
+// one without commits, is recorded as a blame failure of res. It
+// stops early if ctx is done.
+func (s *Scanner) blameSubmodules(ctx context.Context, res *Result) {
+	for _, sub := range res.Submodules {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := sub.scanner.Blame(ctx, sub.Result); err != nil && ctx.Err() == nil {
+			res.blameFailed(sub.scanner.root, BlameFailedSubmodule, err)
+		}
+	}
+}
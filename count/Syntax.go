@@ -0,0 +1,169 @@
+/*
+count/Syntax.go
+
+Comment and string literal syntax of the languages detected by enry,
+used to split counted lines into code, comment and blank lines. Only
+what is needed to find comments is described: line comments, block
+comments (optionally nested) and the string literals that may contain
+comment markers. Languages without an entry only have code and blank
+lines.
+*/
+
+package count
+
+// Comment and string literal syntax of a language
+type languageSyntax struct {
+	lineComments  []string
+	blockComments []blockComment
+	// Checked in order, so longer delimiters sharing a prefix come first
+	strings []stringLiteral
+}
+
+type blockComment struct {
+	start string
+	end   string
+	// Block comments may contain other block comments
+	nested bool
+}
+
+type stringLiteral struct {
+	// Opening and closing delimiter
+	delim string
+	// Backslashes don't escape the delimiter
+	raw bool
+	// The literal may span several lines
+	multiline bool
+}
+
+// Building blocks shared by language families
+var (
+	slashComments = []string{"//"}
+	hashComments  = []string{"#"}
+	dashComments  = []string{"--"}
+	semiComments  = []string{";"}
+	percComments  = []string{"%"}
+
+	cBlock      = []blockComment{{start: "/*", end: "*/"}}
+	nestedBlock = []blockComment{{start: "/*", end: "*/", nested: true}}
+	htmlBlock   = []blockComment{{start: "<!--", end: "-->"}}
+	mlBlock     = []blockComment{{start: "(*", end: "*)", nested: true}}
+
+	doubleQuoted = stringLiteral{delim: `"`}
+	singleQuoted = stringLiteral{delim: `'`}
+	backtick     = stringLiteral{delim: "`", multiline: true}
+	tripleQuoted = stringLiteral{delim: `"""`, multiline: true}
+
+	cStrings      = []stringLiteral{doubleQuoted, singleQuoted}
+	jsStrings     = []stringLiteral{doubleQuoted, singleQuoted, backtick}
+	jvmStrings    = []stringLiteral{tripleQuoted, doubleQuoted, singleQuoted}
+	doubleStrings = []stringLiteral{doubleQuoted}
+)
+
+var cFamily = languageSyntax{lineComments: slashComments, blockComments: cBlock, strings: cStrings}
+var jsFamily = languageSyntax{lineComments: slashComments, blockComments: cBlock, strings: jsStrings}
+var jvmFamily = languageSyntax{lineComments: slashComments, blockComments: cBlock, strings: jvmStrings}
+var hashFamily = languageSyntax{lineComments: hashComments, strings: cStrings}
+var lispFamily = languageSyntax{lineComments: semiComments, strings: doubleStrings}
+var markupFamily = languageSyntax{blockComments: htmlBlock}
+
+// Syntax by enry language name
+var languageSyntaxes = map[string]languageSyntax{
+	"C":                  cFamily,
+	"C++":                cFamily,
+	"C#":                 cFamily,
+	"Cuda":               cFamily,
+	"D":                  {lineComments: slashComments, blockComments: []blockComment{{start: "/+", end: "+/", nested: true}, cBlock[0]}, strings: jsStrings},
+	"GLSL":               cFamily,
+	"Java":               jvmFamily,
+	"JavaScript":         jsFamily,
+	"JSON with Comments": cFamily,
+	"Jsonnet":            {lineComments: []string{"//", "#"}, blockComments: cBlock, strings: cStrings},
+	"Objective-C":        cFamily,
+	"Objective-C++":      cFamily,
+	"Protocol Buffer":    cFamily,
+	"Solidity":           cFamily,
+	"Thrift":             {lineComments: []string{"//", "#"}, blockComments: cBlock, strings: cStrings},
+	"TSX":                jsFamily,
+	"TypeScript":         jsFamily,
+	"Vala":               jvmFamily,
+	"Verilog":            cFamily,
+	"SystemVerilog":      cFamily,
+	"Haxe":               cFamily,
+	"V":                  jsFamily,
+
+	"Go":     {lineComments: slashComments, blockComments: cBlock, strings: []stringLiteral{doubleQuoted, singleQuoted, {delim: "`", raw: true, multiline: true}}},
+	"Rust":   {lineComments: slashComments, blockComments: nestedBlock, strings: doubleStrings},
+	"Swift":  {lineComments: slashComments, blockComments: nestedBlock, strings: []stringLiteral{tripleQuoted, doubleQuoted}},
+	"Kotlin": {lineComments: slashComments, blockComments: nestedBlock, strings: jvmStrings},
+	"Scala":  {lineComments: slashComments, blockComments: nestedBlock, strings: jvmStrings},
+	"Groovy": jvmFamily,
+	"Gradle": jvmFamily,
+	"Dart":   {lineComments: slashComments, blockComments: nestedBlock, strings: []stringLiteral{tripleQuoted, {delim: "'''", multiline: true}, doubleQuoted, singleQuoted}},
+	"Zig":    {lineComments: slashComments, strings: cStrings},
+	"Gleam":  {lineComments: slashComments, strings: doubleStrings},
+	"PHP":    {lineComments: []string{"//", "#"}, blockComments: cBlock, strings: []stringLiteral{{delim: `"`, multiline: true}, {delim: `'`, multiline: true}}},
+
+	"CSS":  {blockComments: cBlock, strings: cStrings},
+	"SCSS": {lineComments: slashComments, blockComments: cBlock, strings: cStrings},
+	"Less": {lineComments: slashComments, blockComments: cBlock, strings: cStrings},
+	"Sass": {lineComments: slashComments, blockComments: cBlock, strings: cStrings},
+
+	"Python":     {lineComments: hashComments, strings: []stringLiteral{tripleQuoted, {delim: "'''", multiline: true}, doubleQuoted, singleQuoted}},
+	"Starlark":   {lineComments: hashComments, strings: []stringLiteral{tripleQuoted, {delim: "'''", multiline: true}, doubleQuoted, singleQuoted}},
+	"Ruby":       {lineComments: hashComments, blockComments: []blockComment{{start: "=begin", end: "=end"}}, strings: cStrings},
+	"Crystal":    hashFamily,
+	"Elixir":     {lineComments: hashComments, strings: []stringLiteral{tripleQuoted, doubleQuoted, singleQuoted}},
+	"Shell":      {lineComments: hashComments, strings: []stringLiteral{doubleQuoted, {delim: `'`, raw: true}}},
+	"Perl":       hashFamily,
+	"R":          hashFamily,
+	"Julia":      {lineComments: hashComments, blockComments: []blockComment{{start: "#=", end: "=#", nested: true}}, strings: []stringLiteral{tripleQuoted, doubleQuoted}},
+	"Nim":        {lineComments: hashComments, blockComments: []blockComment{{start: "#[", end: "]#", nested: true}}, strings: []stringLiteral{tripleQuoted, doubleQuoted}},
+	"PowerShell": {lineComments: hashComments, blockComments: []blockComment{{start: "<#", end: "#>"}}, strings: []stringLiteral{doubleQuoted, {delim: `'`, raw: true}}},
+	"Nix":        {lineComments: hashComments, blockComments: cBlock, strings: []stringLiteral{{delim: "''", raw: true, multiline: true}, doubleQuoted}},
+	"HCL":        {lineComments: []string{"#", "//"}, blockComments: cBlock, strings: doubleStrings},
+	"CMake":      {lineComments: hashComments, blockComments: []blockComment{{start: "#[[", end: "]]"}}, strings: doubleStrings},
+	"Makefile":   {lineComments: hashComments},
+	"Dockerfile": {lineComments: hashComments, strings: cStrings},
+	"YAML":       hashFamily,
+	"TOML":       {lineComments: hashComments, strings: []stringLiteral{tripleQuoted, {delim: "'''", raw: true, multiline: true}, doubleQuoted, {delim: `'`, raw: true}}},
+	"INI":        {lineComments: []string{";", "#"}},
+	"GraphQL":    {lineComments: hashComments, strings: []stringLiteral{tripleQuoted, doubleQuoted}},
+	"Tcl":        {lineComments: hashComments, strings: doubleStrings},
+	"Awk":        {lineComments: hashComments, strings: doubleStrings},
+
+	"SQL":     {lineComments: dashComments, blockComments: cBlock, strings: []stringLiteral{{delim: `'`, multiline: true}, doubleQuoted}},
+	"PLpgSQL": {lineComments: dashComments, blockComments: cBlock, strings: []stringLiteral{{delim: `'`, multiline: true}, doubleQuoted}},
+	"Haskell": {lineComments: dashComments, blockComments: []blockComment{{start: "{-", end: "-}", nested: true}}, strings: doubleStrings},
+	"Elm":     {lineComments: dashComments, blockComments: []blockComment{{start: "{-", end: "-}", nested: true}}, strings: []stringLiteral{tripleQuoted, doubleQuoted}},
+	"Lua":     {lineComments: dashComments, blockComments: []blockComment{{start: "--[[", end: "]]"}}, strings: []stringLiteral{{delim: "[[", raw: true, multiline: true}, doubleQuoted, singleQuoted}},
+	"Ada":     {lineComments: dashComments, strings: doubleStrings},
+	"VHDL":    {lineComments: dashComments, blockComments: cBlock, strings: doubleStrings},
+
+	"Clojure":     lispFamily,
+	"Common Lisp": {lineComments: semiComments, blockComments: []blockComment{{start: "#|", end: "|#", nested: true}}, strings: doubleStrings},
+	"Emacs Lisp":  lispFamily,
+	"Scheme":      {lineComments: semiComments, blockComments: []blockComment{{start: "#|", end: "|#", nested: true}}, strings: doubleStrings},
+	"Racket":      {lineComments: semiComments, blockComments: []blockComment{{start: "#|", end: "|#", nested: true}}, strings: doubleStrings},
+	"Assembly":    {lineComments: []string{";", "#"}, blockComments: cBlock, strings: doubleStrings},
+
+	"OCaml":     {blockComments: mlBlock, strings: doubleStrings},
+	"Coq":       {blockComments: mlBlock, strings: doubleStrings},
+	"F#":        {lineComments: slashComments, blockComments: mlBlock, strings: []stringLiteral{tripleQuoted, doubleQuoted}},
+	"Pascal":    {lineComments: slashComments, blockComments: []blockComment{mlBlock[0], {start: "{", end: "}"}}, strings: []stringLiteral{singleQuoted}},
+	"Smalltalk": {blockComments: []blockComment{{start: `"`, end: `"`}}, strings: []stringLiteral{{delim: `'`, raw: true, multiline: true}}},
+
+	"Erlang":  {lineComments: percComments, strings: doubleStrings},
+	"Prolog":  {lineComments: percComments, blockComments: cBlock, strings: doubleStrings},
+	"TeX":     {lineComments: percComments},
+	"MATLAB":  {lineComments: percComments, blockComments: []blockComment{{start: "%{", end: "%}"}}, strings: doubleStrings},
+	"Fortran": {lineComments: []string{"!"}, strings: cStrings},
+
+	"Batchfile":  {lineComments: []string{"::", "REM ", "rem "}},
+	"Vim Script": {lineComments: []string{`"`}, strings: []stringLiteral{{delim: `'`, raw: true}}},
+
+	"HTML":     markupFamily,
+	"XML":      markupFamily,
+	"Markdown": markupFamily,
+	"Vue":      {lineComments: slashComments, blockComments: []blockComment{htmlBlock[0], cBlock[0]}, strings: jsStrings},
+	"Svelte":   {lineComments: slashComments, blockComments: []blockComment{htmlBlock[0], cBlock[0]}, strings: jsStrings},
+}
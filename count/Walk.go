@@ -2,159 +2,457 @@
 count/Walk.go
 
 Functionality to walk a directory tree while respecting .gitignore files
-and other file exclusion rules set by the user. Exposes a bubbletea-compatible
-Walk function. Counting logic is delegated to count/Counter.CountLines.
+and other file exclusion rules set by the user, or to enumerate the files
+tracked in the git index or in the tree of a given revision. Exposes
+Scanner.Walk and a bubbletea-compatible StartWalk command. Enumerated
+files are filtered, detected and counted in parallel by the pipeline in
+count/WalkPipeline.go.
 */
 
 package count
 
 import (
-	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"sort"
+	"runtime"
 	"strings"
 
-	"github.com/bmatcuk/doublestar/v4"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-type IgnoreFunc func(path string, isDir bool) bool
+// State shared by the recursive calls of walkDir
+type dirWalk struct {
+	root           string
+	followSymlinks bool
+	emit           emitFunc
+	skip           skipFunc
+	onError        errorFunc
+	// Resolved paths of the directories being walked, to detect
+	// symlinks pointing back up the tree
+	ancestors map[string]bool
+	// Path of root within the repository, see OpenRepo
+	prefix string
+	// Submodule directories listed in .gitmodules, handled by onSubmodule
+	submodules  map[string]string
+	onSubmodule submoduleFunc
+}
 
-func loadGitignore(dir string) (IgnoreFunc, error) {
-	gitignorePath := filepath.Join(dir, ".gitignore")
-	f, err := os.Open(gitignorePath)
+// walkDir enumerates the files below dir that aren't excluded by
+// gitignores, passing each one to emit in a stable order. Entries are
+// classified by mode, so only regular files are read and special
+// files are recorded as skipped. Symlinks are skipped unless followed.
+// Directories that can't be read are passed to the walk's onError.
+func walkDir(ctx context.Context, w *dirWalk, dir string, parentIgnore gitignore) error {
+	relDir := repoPath(w.root, w.prefix, dir)
+	currentIgnore, err := loadGitignore(dir, relDir)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
+		return w.onError(dir, PhaseWalk, err)
 	}
-	defer f.Close()
+	// Patterns from deeper .gitignore files take precedence over their parents
+	ignore := parentIgnore.with(currentIgnore)
 
-	// Read in gitignore patterns
-	var patterns []string
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		patterns = append(patterns, line)
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return w.onError(dir, PhaseWalk, err)
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	w.ancestors[realDir] = true
+	defer delete(w.ancestors, realDir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return w.onError(dir, PhaseWalk, err)
 	}
 
-	// Return a function that checks if a path matches any of the patterns
-	return func(path string, isDir bool) bool {
-		rel, err := filepath.Rel(dir, path)
-		if err != nil {
-			return false
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entryPath := filepath.Join(dir, entry.Name())
+		relPath := path.Join(relDir, entry.Name())
+
+		// ignore .git directories, and the .git files of submodules
+		if entry.Name() == ".git" {
+			continue
 		}
-		for _, pattern := range patterns {
-			cleanPattern := pattern
-			if strings.HasSuffix(pattern, "/") {
-				if !isDir {
+
+		// Followed symlinks are walked or counted as their target
+		mode := entry.Type()
+		isSymlink := mode&fs.ModeSymlink != 0
+		var target string
+		if isSymlink && w.followSymlinks {
+			info, statErr := os.Stat(entryPath)
+			if statErr == nil {
+				mode = info.Mode().Type()
+				target, statErr = filepath.EvalSymlinks(entryPath)
+			}
+			if statErr != nil {
+				if !ignore.isIgnored(relPath, false) {
+					w.skip(entryPath, SkipBrokenSymlink)
+				}
+				continue
+			}
+		}
+
+		// check if the entry should be ignored based on gitignores
+		if ignore.isIgnored(relPath, mode.IsDir()) {
+			continue
+		}
+
+		switch {
+		case mode.IsDir():
+			if isSymlink && w.ancestors[target] {
+				w.skip(entryPath, SkipSymlinkCycle)
+				continue
+			}
+			if _, ok := w.submodules[entryPath]; ok {
+				walkInto, err := w.onSubmodule(entryPath, plumbing.ZeroHash)
+				if err != nil {
+					return err
+				}
+				if !walkInto {
 					continue
 				}
-				cleanPattern = strings.TrimSuffix(pattern, "/")
 			}
-			if matched, err := doublestar.PathMatch(cleanPattern, rel); err == nil && matched {
-				return true
+			// Recursively walk directories
+			if err := walkDir(ctx, w, entryPath, ignore); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			// Contents are read by the pipeline workers
+			if err := w.emit(walkEntry{path: entryPath}); err != nil {
+				return err
 			}
+		default:
+			w.skip(entryPath, skipReasonFor(mode))
 		}
-		return false
-	}, nil
+	}
+
+	return nil
 }
 
-func walkDir(root string, parentIgnore IgnoreFunc, fileExclusions *Ignorer) error {
-	currentIgnore, err := loadGitignore(root)
+// walkIndex enumerates every file below root tracked in the index of
+// the repository containing it. Files that are tracked but missing from
+// the working tree are skipped by the pipeline workers, and submodules
+// are passed to onSubmodule.
+func walkIndex(ctx context.Context, root string, emit emitFunc, skip skipFunc, onSubmodule submoduleFunc) error {
+	repo, _, prefix, err := OpenRepo(root)
+	if err != nil {
+		return err
+	}
+	idx, err := repo.Storer.Index()
 	if err != nil {
 		return err
 	}
 
-	// Combine parent and current ignore functions, along with ignoring .git directories
-	ignoreFn := func(path string, isDir bool) bool {
-		if isDir && filepath.Base(path) == ".git" {
-			return true
+	previous := ""
+	for _, entry := range idx.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Conflicted files have one entry per merge stage
+		if entry.Name == previous {
+			continue
+		}
+		previous = entry.Name
+
+		name := entry.Name
+		if prefix != "" {
+			var ok bool
+			if name, ok = strings.CutPrefix(name, prefix+"/"); !ok {
+				continue
+			}
 		}
-		if parentIgnore != nil && parentIgnore(path, isDir) {
-			return true
+		entryPath := filepath.Join(root, filepath.FromSlash(name))
+		if entry.Mode == filemode.Submodule {
+			if _, err := onSubmodule(entryPath, entry.Hash); err != nil {
+				return err
+			}
+			continue
 		}
-		if currentIgnore != nil && currentIgnore(path, isDir) {
-			return true
+		// Skip symlinks, they cannot be counted as files
+		if reason, ok := treeSkipReason(entry.Mode); ok {
+			skip(entryPath, reason)
+			continue
+		}
+		if err := emit(walkEntry{path: entryPath}); err != nil {
+			return err
 		}
-		return false
 	}
 
-	entries, err := os.ReadDir(root)
+	return nil
+}
+
+// walkTree enumerates every file below root in the tree of the commit
+// in repo resolved from rev, where prefix is the path of root within
+// the repository, see OpenRepo. Contents are read from the object
+// database instead of the working tree. The repository handle isn't
+// safe for concurrent use, so contents are read here rather than by the
+// pipeline workers. Blobs that can't be read are passed to onError,
+// and submodules to onSubmodule.
+func walkTree(ctx context.Context, repo *git.Repository, prefix, root, rev string, emit emitFunc, skip skipFunc, onError errorFunc, onSubmodule submoduleFunc) error {
+	commit, err := ResolveCommit(repo, rev)
 	if err != nil {
 		return err
 	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	if prefix != "" {
+		if tree, err = tree.Tree(prefix); err != nil {
+			return err
+		}
+	}
 
-	for _, entry := range entries {
-		entryPath := filepath.Join(root, entry.Name())
-
-		// check if the entry should be ignored based on gitignores
-		if ignoreFn(entryPath, entry.IsDir()) {
+	// Walk the entries rather than the files, which leave out gitlinks
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Mode == filemode.Dir {
 			continue
 		}
 
-		// Recursively walk directories
-		if entry.IsDir() {
-			if err := walkDir(entryPath, ignoreFn, fileExclusions); err != nil {
+		entryPath := filepath.Join(root, filepath.FromSlash(name))
+		if entry.Mode == filemode.Submodule {
+			if _, err := onSubmodule(entryPath, entry.Hash); err != nil {
 				return err
 			}
-		} else {
-			// Load file content for filetype detection
-			content, err := os.ReadFile(entryPath)
-			if err != nil {
+			continue
+		}
+		if reason, ok := treeSkipReason(entry.Mode); ok {
+			skip(entryPath, reason)
+			continue
+		}
+
+		content, err := readBlob(repo, entry.Hash)
+		if err != nil {
+			if err := onError(entryPath, PhaseRead, err); err != nil {
 				return err
 			}
-			// Check if the file should be ignored based on app config
-			if fileExclusions.IsIgnored(entryPath, content) {
-				continue
-			}
-			// Pass the file to count/Counter.CountLines for handling 
-			// filetype detection and line counting
-			CountLines(entryPath, content)
+			continue
+		}
+		if err := emit(walkEntry{path: entryPath, content: content, loaded: true}); err != nil {
+			return err
 		}
 	}
+}
 
-	return nil
+// readBlob returns the contents of the blob with hash.
+func readBlob(repo *git.Repository, hash plumbing.Hash) ([]byte, error) {
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
 }
 
-func Walk(rootDir string, filetypeExclusionConfig IgnoreConfig) tea.Msg {
+// treeSkipReason returns why an index or tree entry with mode can't
+// be counted, ok is false for regular and executable files.
+func treeSkipReason(mode filemode.FileMode) (SkipReason, bool) {
+	switch mode {
+	case filemode.Regular, filemode.Executable, filemode.Deprecated:
+		return "", false
+	case filemode.Symlink:
+		return SkipSymlink, true
+	case filemode.Submodule:
+		return SkipSubmodule, true
+	}
+	return SkipIrregular, true
+}
+
+// relativeSlashPath returns target relative to root using forward slashes,
+// with "" for root itself.
+func relativeSlashPath(root, target string) string {
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Walk enumerates and counts the files selected by the scanner's
+// options, returning a new Result. Files of a bare repository are read
+// from the tree of HEAD or the given revision. Files and directories that can't be
+// read are recorded in the Result's Errors, unless the scan is strict
+// in which case the first one stops the walk. If ctx is done before
+// the walk finishes, the files counted so far are returned in a Result
+// marked incomplete along with the context's error.
+func (s *Scanner) Walk(ctx context.Context) (*Result, error) {
+	// Bare repositories have no working directory, so their files are
+	// always read from a tree, HEAD's unless a revision is given
+	repo, repoRoot, prefix, repoErr := s.openRepo()
+	var gitDir string
+	if repoErr != nil {
+		// A directory outside of a repository is its own root
+		repo, repoRoot, prefix = nil, s.root, ""
+	} else {
+		gitDir = repoCommonDir(repo)
+	}
+	rev := s.options.Rev
+	if rev == "" && repo != nil && isBare(repo) {
+		rev = "HEAD"
+	}
+	if rev != "" && repoErr != nil {
+		return nil, repoErr
+	}
+
+	// Load .gitattributes from the tree being counted, so linguist
+	// overrides apply to the exclusions and detected languages
+	var attrs *gitattributes
+	var err error
+	if rev != "" {
+		attrs, err = newTreeGitattributes(repo, s.root, prefix, rev)
+	} else {
+		attrs, err = newGitattributes(s.root, repoRoot, prefix, gitDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Ignore files are read from disk, which cloned repositories aren't on
+	var ignoreFile FilterFunc
+	if s.repo == nil {
+		ignoreFile = WithIgnoreFile(s.root, WhodunnitIgnoreFile)
+	}
+
 	// Create ignorer from exclusion config
 	fileExclusions := NewIgnorer(
-		WithDotFiles(filetypeExclusionConfig.IgnoreDotFiles),
-		WithConfigFiles(filetypeExclusionConfig.IgnoreConfigFiles),
-		WithGeneratedFiles(filetypeExclusionConfig.IgnoreGeneratedFiles),
-		WithVendorFiles(filetypeExclusionConfig.IgnoreVendorFiles),
+		WithDotFiles(s.ignore.IgnoreDotFiles),
+		WithConfigFiles(s.ignore.IgnoreConfigFiles),
+		attrs.generatedFilter(s.ignore.IgnoreGeneratedFiles),
+		attrs.vendorFilter(s.ignore.IgnoreVendorFiles),
+		attrs.linguistFilter(),
+		WithExcludeGlobs(s.root, s.ignore.Exclude),
+		WithIncludeGlobs(s.root, s.ignore.Include),
+		ignoreFile,
 	)
 
-	if err := walkDir(rootDir, nil, fileExclusions); err != nil {
-		return WalkErrorMsg{Err: err}
+	submodules, err := loadSubmodules(repo, repoRoot, prefix, s.root, rev)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create alphabetical and count sorted key lists
-	var FileTypeKeys []string
-	for k := range Counts {
-		FileTypeKeys = append(FileTypeKeys, k)
+	res := newResult(s.root)
+	onError := res.onError(s.options)
+	var found []foundSubmodule
+	var produce func(emit emitFunc) error
+	if rev != "" {
+		// Files in a commit are tracked by definition, so gitignores don't apply
+		produce = func(emit emitFunc) error {
+			onSubmodule := s.submoduleHandler(ctx, res, emit, onError, &found)
+			return walkTree(ctx, repo, prefix, s.root, rev, emit, res.skip, onError, onSubmodule)
+		}
+	} else if s.options.TrackedOnly {
+		// The index already reflects what git tracks, so gitignores don't apply
+		produce = func(emit emitFunc) error {
+			onSubmodule := s.submoduleHandler(ctx, res, emit, onError, &found)
+			return walkIndex(ctx, s.root, emit, res.skip, onSubmodule)
+		}
+	} else {
+		produce = func(emit emitFunc) error {
+			// Global excludes and .git/info/exclude apply below every
+			// .gitignore, followed by those above a scanned subdirectory
+			repoExcludes, err := loadRepoExcludes(gitDir)
+			if err != nil {
+				return err
+			}
+			parentIgnores, err := loadParentGitignores(repoRoot, prefix)
+			if err != nil {
+				return err
+			}
+			return walkDir(ctx, &dirWalk{
+				root:           s.root,
+				prefix:         prefix,
+				submodules:     submodules,
+				onSubmodule:    s.submoduleHandler(ctx, res, emit, onError, &found),
+				followSymlinks: s.options.FollowSymlinks,
+				emit:           emit,
+				skip:           res.skip,
+				onError:        onError,
+				ancestors:      make(map[string]bool),
+			}, s.root, repoExcludes.with(parentIgnores))
+		}
+	}
+
+	err = runWalkPipeline(ctx, s.options.jobs(runtime.NumCPU()), fileExclusions, attrs, onError, res, produce)
+	if err != nil {
+		// Keep what was counted if the walk was cut short
+		if ctx.Err() == nil {
+			return nil, err
+		}
+		res.Incomplete = true
+		err = ctx.Err()
 	}
-	sort.Strings(FileTypeKeys)
 
-	SortedCountsKeys := make([]string, len(FileTypeKeys))
-	copy(SortedCountsKeys, FileTypeKeys)
-	sort.Slice(SortedCountsKeys, func(i, j int) bool {
-		return Counts[SortedCountsKeys[i]].Count > Counts[SortedCountsKeys[j]].Count
-	})
+	// Submodules are scanned after the superproject, keeping their
+	// files out of its counts
+	if err == nil {
+		err = s.walkSubmodules(ctx, res, found, submodules, onError)
+		if err != nil {
+			if ctx.Err() == nil {
+				return nil, err
+			}
+			res.Incomplete = true
+		}
+	}
+
+	res.sortCounts()
+	res.sortSkipped()
+	res.sortErrors()
+	res.Tree = res.dirTree(nil)
+	return res, err
+}
+
+// Bubble tea compatible command to walk the directory. A walk that
+// timed out is reported as done with its partial result.
+func (s *Scanner) StartWalk(ctx context.Context) tea.Cmd {
+	return func() tea.Msg {
+		res, err := s.Walk(ctx)
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return WalkErrorMsg{Err: err}
+		}
+		return res.walkDoneMsg()
+	}
+}
 
+func (r *Result) walkDoneMsg() WalkDoneMsg {
+	r.locker.Lock()
+	defer r.locker.Unlock()
 	return WalkDoneMsg{
-		Counts:                 Counts,
-		SortedAlphabeticalKeys: FileTypeKeys,
-		SortedCountsKeys:       SortedCountsKeys,
-		TotalLines:             TotalLines,
+		Result:                 r,
+		Counts:                 r.Counts,
+		SortedAlphabeticalKeys: r.SortedAlphabeticalKeys,
+		SortedCountsKeys:       r.SortedCountsKeys,
+		TotalLines:             r.TotalLines,
+		Totals:                 r.Totals,
+		Tree:                   r.Tree,
+		Skipped:                r.Skipped,
+		Errors:                 r.Errors,
+		Submodules:             r.Submodules,
+		Incomplete:             r.Incomplete,
 	}
 }
@@ -0,0 +1,168 @@
+/*
+count/WalkPipeline.go
+
+Bounded worker pipeline behind Scanner.Walk. A single producer
+enumerates files and applies gitignores, then workers read, filter,
+detect and count them in parallel. Every file is numbered in the order
+it was enumerated and results are recorded in that order, so the Result
+is the same no matter how the work was scheduled.
+*/
+
+package count
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+)
+
+// A file enumerated by the walk
+type walkEntry struct {
+	index int
+	path  string
+	// Contents read by the producer, otherwise workers read path from disk
+	content []byte
+	loaded  bool
+}
+
+// A counted file, in the enumeration order given by index
+type walkCount struct {
+	index int
+	path  string
+	lines FileCount
+	// Set if the file turned out not to be a regular file
+	skipped SkipReason
+}
+
+// Passes an enumerated file on to the workers, blocking while they are busy
+type emitFunc func(entry walkEntry) error
+
+// runWalkPipeline counts the files enumerated by produce with the given
+// number of workers and records them in res in enumeration order. Files
+// that can't be read are passed to onError, and the first error it or
+// the producer returns stops the pipeline. Files counted before the
+// pipeline stopped are still recorded.
+func runWalkPipeline(ctx context.Context, jobs int, fileExclusions *Ignorer, attrs *gitattributes, onError errorFunc, res *Result, produce func(emit emitFunc) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	entries := make(chan walkEntry, jobs*4)
+	counts := make(chan walkCount, jobs*4)
+
+	var workerErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			workerErr = err
+			cancel()
+		})
+	}
+
+	// start workers
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	for w := 0; w < jobs; w++ {
+		go func() {
+			defer wg.Done()
+			for entry := range entries {
+				if ctx.Err() != nil {
+					continue
+				}
+				count, ok, err := countEntry(entry, fileExclusions, attrs)
+				if err != nil {
+					if err := onError(entry.path, PhaseRead, err); err != nil {
+						fail(err)
+					}
+					continue
+				}
+				if ok {
+					counts <- count
+				}
+			}
+		}()
+	}
+
+	// collect counts as they finish
+	var collected []walkCount
+	collectorDone := make(chan struct{})
+	go func() {
+		for count := range counts {
+			collected = append(collected, count)
+		}
+		close(collectorDone)
+	}()
+
+	// enumerate files, numbering them as they are handed out
+	index := 0
+	err := produce(func(entry walkEntry) error {
+		entry.index = index
+		select {
+		case entries <- entry:
+			index++
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(entries)
+	wg.Wait()
+	close(counts)
+	<-collectorDone
+
+	// Record in enumeration order
+	sort.Slice(collected, func(i, j int) bool {
+		return collected[i].index < collected[j].index
+	})
+	for _, count := range collected {
+		if count.skipped != "" {
+			res.skip(count.path, count.skipped)
+			continue
+		}
+		res.record(count.path, count.lines)
+	}
+
+	// A worker error cancels the producer, so report the cause
+	if workerErr != nil {
+		return workerErr
+	}
+	return err
+}
+
+// countEntry reads, filters, detects and counts a single file. ok is
+// false if the file was excluded or no longer exists. Files read from
+// disk that aren't regular files, such as a named pipe in place of a
+// tracked file, are returned as skipped without being read. linguist-language
+// in attrs overrides the detected language.
+func countEntry(entry walkEntry, fileExclusions *Ignorer, attrs *gitattributes) (walkCount, bool, error) {
+	content := entry.content
+	if !entry.loaded {
+		info, err := os.Stat(entry.path)
+		if err == nil && !info.Mode().IsRegular() {
+			return walkCount{
+				index:   entry.index,
+				path:    entry.path,
+				skipped: skipReasonFor(info.Mode().Type()),
+			}, true, nil
+		}
+		content, err = os.ReadFile(entry.path)
+		if err != nil {
+			// Removed since it was enumerated
+			if os.IsNotExist(err) {
+				return walkCount{}, false, nil
+			}
+			return walkCount{}, false, err
+		}
+	}
+
+	// Check if the file should be ignored based on app config
+	if fileExclusions.IsIgnored(entry.path, content) {
+		return walkCount{}, false, nil
+	}
+
+	return walkCount{
+		index: entry.index,
+		path:  entry.path,
+		lines: countFile(entry.path, content, attrs.language(entry.path)),
+	}, true, nil
+}
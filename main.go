@@ -8,27 +8,42 @@ sets up the TUI or JSON export.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/connorgannaway/whodunnit/count"
 	"github.com/connorgannaway/whodunnit/tui"
 	"github.com/connorgannaway/whodunnit/tui/JsonExport"
+	"github.com/go-git/go-git/v5"
 )
 
 
 var Version = "dev"
 
+// Flag value that collects every occurrence of a repeated flag
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func init() {
 	var BoldUnderline = lipgloss.NewStyle().Bold(true).Underline(true)
 
 	// Override the default usage function with a custom message
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "%s\n  %s [options] [repo]\n\n",BoldUnderline.Render("Usage:"), os.Args[0])
+		fmt.Fprintf(os.Stderr, "%s\n  %s [options] [repo|url]\n  %s batch [options] [dir|list]\n  %s cache clear [repo]\n\n",BoldUnderline.Render("Usage:"), os.Args[0], os.Args[0], os.Args[0])
 
 		fmt.Fprintln(os.Stderr, BoldUnderline.Render("Options:"))
 		flag.PrintDefaults()
@@ -41,6 +56,27 @@ func init() {
   # scan all files, including configuration files, of the target directory and output to JSON
   whodunnit --withConfigFiles --json repos/target
 
+  # only count Go files outside of the testdata directories
+  whodunnit --include '**/*.go' --exclude '**/testdata'
+
+  # count and blame every submodule on its own
+  whodunnit --submodules recurse
+
+  # scan a remote repository without cloning it to disk
+  whodunnit --depth 100 https://github.com/connorgannaway/whodunnit
+
+  # stream every blamed line range as newline delimited json
+  whodunnit --format=ndjson-lines > blame.ndjson
+
+  # scan every repository below a directory and export one report
+  whodunnit batch --json mirrors/
+
+  # scan a release tag without checking it out
+  whodunnit --rev v1.0.0
+
+  # only attribute lines changed during 2024
+  whodunnit --since 2024-01-01 --until 2024-12-31
+
 For more information, see https://github.com/connorgannaway/whodunnit.
 `, BoldUnderline.Render("Examples:"))
 	}
@@ -48,33 +84,81 @@ For more information, see https://github.com/connorgannaway/whodunnit.
 
 
 func main() {
+	// Handle subcommands before flags. batch takes the same flags
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		runCacheCommand(os.Args[2:])
+		return
+	}
+	args := os.Args[1:]
+	batch := len(args) > 0 && args[0] == "batch"
+	if batch {
+		args = args[1:]
+	}
+
 	// Define and parse command-line flags
 	df := flag.Bool("withDotFiles", false, "include dot files")
 	cf := flag.Bool("withConfigFiles", false, "include config files")
 	gf := flag.Bool("withGeneratedFiles", false, "include generated files")
 	vf := flag.Bool("withVendorFiles", false, "include vendor files")
+	var excludes, includes stringSlice
+	flag.Var(&excludes, "exclude", "skip files matching this glob, relative to the repo (repeatable)")
+	flag.Var(&includes, "include", "only count files matching this glob, relative to the repo (repeatable)")
 	verf := flag.Bool("version", false, "print version")
+	to := flag.Bool("tracked-only", false, "only count files tracked in the git index")
+	follow := flag.Bool("follow-symlinks", false, "walk into symlinked directories and count symlinked files instead of skipping them")
+	submodules := flag.String("submodules", string(count.SubmodulesCount), "count submodules with the repo, skip them, or recurse to count and blame each one on its own")
+	clone := flag.Bool("clone", false, "clone the repo into memory and scan that, writing nothing to disk (implied for URLs)")
+	branch := flag.String("branch", "", "branch or tag to clone instead of the remote's HEAD, when cloning")
+	depth := flag.Int("depth", 0, "number of commits of history to clone, 0 for all of it")
+	rev := flag.String("rev", "", "count and blame the tree of a commit-ish (branch, tag or SHA) instead of the working directory")
+	since := flag.String("since", "", "only attribute lines changed on or after this date (YYYY-MM-DD or RFC 3339)")
+	until := flag.String("until", "", "only attribute lines changed on or before this date (YYYY-MM-DD or RFC 3339)")
+	groupBy := flag.String("group-by", string(count.GroupByMailmap), "group authors by name, email or mailmap")
+	mailmap := flag.String("mailmap", "", "mailmap file layered on top of the repository's .mailmap")
+	var ignoreRevs stringSlice
+	flag.Var(&ignoreRevs, "ignore-rev", "attribute lines changed by this revision to the previous author (repeatable)")
+	noCache := flag.Bool("no-cache", false, "blame every file instead of using the on-disk blame cache")
+	backend := flag.String("blame-backend", string(count.BackendAuto), "blame with auto, gogit or git (auto uses git when it is on PATH)")
+	jobs := flag.Int("jobs", 0, "number of files to walk and blame in parallel, 0 picks based on the number of CPUs")
+	strict := flag.Bool("strict", false, "stop at the first file or directory that can't be read instead of reporting it and carrying on")
+	timeout := flag.Duration("timeout", 0, "stop scanning after this long (e.g. 30s) and report partial results, 0 for no limit")
 	json := flag.Bool("json", false, "write json to stdout")
-	flag.Parse()
+	format := flag.String("format", "", "write json, or ndjson-lines for one record per blamed line range, to stdout instead of launching the TUI")
+	flag.CommandLine.Parse(args)
 
 	if *verf {
 		fmt.Printf("Version: %s\n", Version)
 		return
 	}
 
-	// Grab directory from first arg
+	// Grab directory, URL or batch list from first arg
 	rootfs := flag.Arg(0)
 	if rootfs == "" {
 		rootfs = "."
 	}
 
-	// ensure directory and not file
-	dir, err := os.Stat(rootfs)
-	if err != nil {
-		log.Fatal(err)
+	// URLs are always cloned into memory, directories only if asked.
+	// Batches clone the URLs they list
+	cloning := *clone || count.IsRepoURL(rootfs)
+	if batch && cloning {
+		log.Fatal("batch takes a directory or a list file, URLs to clone can be listed in the file")
+	}
+	if !batch && !cloning && (*branch != "" || *depth != 0) {
+		log.Fatal("--branch and --depth only apply when cloning a URL or with --clone")
+	}
+	if *depth < 0 {
+		log.Fatalf("invalid depth %d, expected 0 or more", *depth)
 	}
-	if !dir.IsDir() {
-		log.Fatalf("%s is not a directory", rootfs)
+
+	// ensure directory and not file
+	if !batch && !cloning {
+		dir, err := os.Stat(rootfs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !dir.IsDir() {
+			log.Fatalf("%s is not a directory", rootfs)
+		}
 	}
 
 	// Set up the ignore config based on flags
@@ -83,11 +167,115 @@ func main() {
 		IgnoreConfigFiles:    !*cf,
 		IgnoreGeneratedFiles: !*gf,
 		IgnoreVendorFiles:    !*vf,
+		Include:              includes,
+		Exclude:              excludes,
+	}
+	if err := count.ValidateGlobs(includes); err != nil {
+		log.Fatal(err)
+	}
+	if err := count.ValidateGlobs(excludes); err != nil {
+		log.Fatal(err)
 	}
 
-	// Run without TUI if --json flag is set
+	dateRange, err := count.ParseDateRange(*since, *until)
+	if err != nil {
+		log.Fatal(err)
+	}
+	group, err := count.ParseGroupBy(*groupBy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	backendKind, err := count.ParseBackendKind(*backend)
+	if err != nil {
+		log.Fatal(err)
+	}
+	submoduleMode, err := count.ParseSubmoduleMode(*submodules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// --json is short for --format=json
 	if *json {
-		out, err := JsonExport.ExportJSON(rootfs, *filetypeIgnoreConfig)
+		if *format != "" && *format != "json" {
+			log.Fatalf("--json can't be combined with --format=%s", *format)
+		}
+		*format = "json"
+	}
+	switch *format {
+	case "", "json":
+	case "ndjson-lines":
+		if batch {
+			log.Fatal("--format=ndjson-lines doesn't apply to batch, scan each repository on its own")
+		}
+	default:
+		log.Fatalf("invalid format %q, expected json or ndjson-lines", *format)
+	}
+
+	if *jobs < 0 {
+		log.Fatalf("invalid jobs %d, expected 0 or more", *jobs)
+	}
+
+	// Set up the walk and blame options based on flags
+	options := count.Options{
+		TrackedOnly:    *to,
+		FollowSymlinks: *follow,
+		Rev:            *rev,
+		DateRange:      dateRange,
+		GroupBy:        group,
+		Mailmap:        *mailmap,
+		IgnoreRevs:     ignoreRevs,
+		NoCache:        *noCache,
+		Backend:        backendKind,
+		Timeout:        *timeout,
+		Jobs:           *jobs,
+		Strict:         *strict,
+		Submodules:     submoduleMode,
+	}
+
+	cloneOptions := count.CloneOptions{
+		Branch: *branch,
+		Depth:  *depth,
+	}
+	if batch {
+		runBatch(rootfs, filetypeIgnoreConfig, options, cloneOptions, *format == "json")
+		return
+	}
+
+	// Clone and scan under one context, so --timeout bounds both
+	ctx, cancel := options.Context(context.Background())
+	defer cancel()
+
+	// Clone into memory before scanning, nothing is written to disk
+	var repo *git.Repository
+	if cloning {
+		fmt.Fprintf(os.Stderr, "Cloning %s...\n", rootfs)
+		repo, err = count.CloneRepo(ctx, rootfs, cloneOptions)
+		if err != nil {
+			log.Fatalf("clone failed: %v", err)
+		}
+	}
+
+	// Stream line ranges without TUI if --format=ndjson-lines is set
+	if *format == "ndjson-lines" {
+		scanner := count.NewScanner(rootfs, *filetypeIgnoreConfig, options)
+		if repo != nil {
+			scanner = count.NewRepoScanner(repo, count.RepoName(rootfs), *filetypeIgnoreConfig, options)
+		}
+		if err := JsonExport.ExportLineRanges(ctx, scanner, options, os.Stdout); err != nil {
+			log.Fatalf("ndjson export failed: %v", err)
+		}
+		return
+	}
+
+	// Run without TUI if --json flag is set
+	if *format == "json" {
+		var out []byte
+		if repo != nil {
+			scanner := count.NewRepoScanner(repo, count.RepoName(rootfs), *filetypeIgnoreConfig, options)
+			out, err = JsonExport.ExportScannerJSON(ctx, scanner, *filetypeIgnoreConfig, options)
+		} else {
+			out, err = JsonExport.ExportJSON(ctx, rootfs, *filetypeIgnoreConfig, options)
+		}
 		if err != nil {
 			log.Fatalf("json export failed: %v", err)
 		}
@@ -96,8 +284,14 @@ func main() {
 	}
 
 	// Create TUI
+	var model tea.Model
+	if repo != nil {
+		model = tui.NewClonedRootModel(repo, rootfs, filetypeIgnoreConfig, options)
+	} else {
+		model = tui.NewRootModel(rootfs, filetypeIgnoreConfig, options)
+	}
 	program := tea.NewProgram(
-		tui.NewRootModel(rootfs, filetypeIgnoreConfig),
+		model,
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(),
 	)
@@ -109,3 +303,46 @@ func main() {
 	}
 
 }
+
+// runBatch scans every repository below the directory, or listed in
+// the file, at target and shows them in the TUI or exports them to JSON.
+func runBatch(target string, ign *count.IgnoreConfig, opts count.Options, cloneOpts count.CloneOptions, json bool) {
+	batch, err := count.NewBatch(target, *ign, opts, cloneOpts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if json {
+		out, err := JsonExport.ExportBatchJSON(context.Background(), batch, *ign, opts)
+		if err != nil {
+			log.Fatalf("json export failed: %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	program := tea.NewProgram(
+		tui.NewBatchRootModel(batch, ign, opts),
+		tea.WithAltScreen(),
+		tea.WithMouseCellMotion(),
+	)
+	if _, err := program.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// runCacheCommand handles "whodunnit cache clear [repo]".
+func runCacheCommand(args []string) {
+	if len(args) == 0 || args[0] != "clear" {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s cache clear [repo]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	rootfs := "."
+	if len(args) > 1 {
+		rootfs = args[1]
+	}
+	if err := count.ClearBlameCache(rootfs); err != nil {
+		log.Fatalf("clearing cache failed: %v", err)
+	}
+}
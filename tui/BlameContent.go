@@ -3,7 +3,9 @@ tui/BlameContent.go
 
 Implementation of the blame content model for the TUI.
 This model displays per-author git blame line counts broken down by
-filetype. This is rendered in a viewport on the right side of the TUI.
+filetype, followed by the lines falling outside the selected date range
+and the authors of each submodule blamed on its own.
+This is rendered in a viewport on the right side of the TUI.
 */
 
 package tui
@@ -23,6 +25,12 @@ import (
 type blameContentModel struct {
 	counts               map[string]*count.BlameCount
 	sortedCountsKeyArray []string
+	older                *count.BlameCount
+	newer                *count.BlameCount
+	dateRange            count.DateRange
+	groupBy              count.GroupBy
+	incomplete           bool
+	submodules           []*count.SubmoduleResult
 	isGitRepo            bool
 	sortBy               SortType
 
@@ -58,71 +66,52 @@ func (c blameContentModel) generateContent() string {
 		authorColWidth = FILETYPE_WIDTH
 	}
 
-	if len(c.sortedCountsKeyArray) > 0 {
+	if len(c.sortedCountsKeyArray) > 0 || c.older != nil || c.newer != nil || c.incomplete {
+
+		// Show the active date range and grouping above the authors
+		var settings []string
+		if c.incomplete {
+			settings = append(settings, boldText.Render("Incomplete: ")+"timed out before every file was blamed")
+		}
+		if !c.dateRange.IsZero() {
+			settings = append(settings, boldText.Render("Range: ")+c.dateRange.String())
+		}
+		if c.groupBy != "" && c.groupBy != count.GroupByMailmap {
+			settings = append(settings, boldText.Render("Grouped by: ")+string(c.groupBy))
+		}
+		for _, line := range settings {
+			content += lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line) + "\n"
+		}
+		if len(settings) > 0 {
+			content += "\n"
+		}
 
 		// Loop through the map by the sorted counts keys 
 		// to display authors in order of total lines
 		for _, k := range c.sortedCountsKeyArray {
+			content += c.renderBlameCount(c.counts[k], vpWidth, authorColWidth, lipgloss.NewStyle())
+		}
 
-			// generate author's name and total lines
-			authorStr := lipgloss.NewStyle().
-				Align(lipgloss.Left).
-				Bold(true).
-				Width(authorColWidth).
-				Render(truncateString(c.counts[k].Author, authorColWidth))
-			totalStr := lipgloss.NewStyle().
-				Align(lipgloss.Right).
-				Bold(true).
-				Width(COUNT_WIDTH).
-				Render(strconv.Itoa(c.counts[k].Count))
-			line := authorStr + totalStr
-			if vpWidth > CONTENT_TOTAL_WIDTH {
-				line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+		// Lines outside the date range are shown last and dimmed
+		for _, bc := range []*count.BlameCount{c.older, c.newer} {
+			if bc != nil {
+				content += c.renderBlameCount(bc, vpWidth, authorColWidth, outsideRangeStyle)
 			}
-			content += line + "\n"
-
-			// select sort keys to use based on sort type
-			var LinesByTypeKeys []string
-			if c.sortBy == SortTypeAlphabetical {
-				LinesByTypeKeys = c.counts[k].SortedAlphabeticalKeys
-			} else {
-				LinesByTypeKeys = c.counts[k].SortedCountsKeys
-			}
-
-			// Loop through an author's filetypes and counts
-			for _, j := range LinesByTypeKeys {
-				f := c.counts[k].LinesByType[j]
-
-				// recalculate width with indentation
-				var filetypeColWidth int
-				if vpWidth < CONTENT_TOTAL_WIDTH {
-					filetypeColWidth = vpWidth - COUNT_WIDTH - 2
-					if filetypeColWidth < 0 {
-						filetypeColWidth = 0
-					}
-				} else {
-					filetypeColWidth = FILETYPE_WIDTH - 2
-				}
+		}
 
-				// create filetype and count string
-				colorCode := enry.GetColor(f.Filetype)
-				truncatedFiletype := truncateString(f.Filetype, filetypeColWidth)
-				filetypeStr := lipgloss.NewStyle().
-					Foreground(lipgloss.Color(colorCode)).
-					Align(lipgloss.Left).
-					Width(filetypeColWidth).
-					Render(truncatedFiletype)
-				countStr := lipgloss.NewStyle().
-					Align(lipgloss.Right).
-					Width(COUNT_WIDTH).
-					Render(strconv.Itoa(f.Count))
-				line = "  " + filetypeStr + countStr
-				if vpWidth > CONTENT_TOTAL_WIDTH {
-					line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+		// Each submodule's authors are grouped under its path
+		for _, sub := range c.submodules {
+			res := sub.Result
+			header := boldText.Render("Submodule: ") + sub.Path
+			content += lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, header) + "\n\n"
+			for _, k := range res.SortedBlameKeys {
+				content += c.renderBlameCount(res.BlameCounts[k], vpWidth, authorColWidth, lipgloss.NewStyle())
+			}
+			for _, bc := range []*count.BlameCount{res.BlameOlder, res.BlameNewer} {
+				if bc != nil {
+					content += c.renderBlameCount(bc, vpWidth, authorColWidth, outsideRangeStyle)
 				}
-				content += line + "\n"
 			}
-			content += "\n"
 		}
 	} else {
 		if c.isGitRepo {
@@ -134,6 +123,72 @@ func (c blameContentModel) generateContent() string {
 	return content
 }
 
+// renderBlameCount renders an author's total followed by their
+// per-filetype counts in the current sort order.
+func (c blameContentModel) renderBlameCount(bc *count.BlameCount, vpWidth, authorColWidth int, style lipgloss.Style) string {
+	var content string
+
+	// generate author's name and total lines
+	authorStr := style.
+		Align(lipgloss.Left).
+		Bold(true).
+		Width(authorColWidth).
+		Render(truncateString(bc.Author, authorColWidth))
+	totalStr := style.
+		Align(lipgloss.Right).
+		Bold(true).
+		Width(COUNT_WIDTH).
+		Render(strconv.Itoa(bc.Count))
+	line := authorStr + totalStr
+	if vpWidth > CONTENT_TOTAL_WIDTH {
+		line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+	}
+	content += line + "\n"
+
+	// select sort keys to use based on sort type
+	var LinesByTypeKeys []string
+	if c.sortBy == SortTypeAlphabetical {
+		LinesByTypeKeys = bc.SortedAlphabeticalKeys
+	} else {
+		LinesByTypeKeys = bc.SortedCountsKeys
+	}
+
+	// Loop through an author's filetypes and counts
+	for _, j := range LinesByTypeKeys {
+		f := bc.LinesByType[j]
+
+		// recalculate width with indentation
+		var filetypeColWidth int
+		if vpWidth < CONTENT_TOTAL_WIDTH {
+			filetypeColWidth = vpWidth - COUNT_WIDTH - 2
+			if filetypeColWidth < 0 {
+				filetypeColWidth = 0
+			}
+		} else {
+			filetypeColWidth = FILETYPE_WIDTH - 2
+		}
+
+		// create filetype and count string
+		colorCode := enry.GetColor(f.Filetype)
+		truncatedFiletype := truncateString(f.Filetype, filetypeColWidth)
+		filetypeStr := lipgloss.NewStyle().
+			Foreground(lipgloss.Color(colorCode)).
+			Align(lipgloss.Left).
+			Width(filetypeColWidth).
+			Render(truncatedFiletype)
+		countStr := style.
+			Align(lipgloss.Right).
+			Width(COUNT_WIDTH).
+			Render(strconv.Itoa(f.Count))
+		line = "  " + filetypeStr + countStr
+		if vpWidth > CONTENT_TOTAL_WIDTH {
+			line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+		}
+		content += line + "\n"
+	}
+	return content + "\n"
+}
+
 func (c *blameContentModel) Update(msg tea.Msg, width, height int) tea.Cmd {
 	var cmds []tea.Cmd
 
@@ -141,6 +196,12 @@ func (c *blameContentModel) Update(msg tea.Msg, width, height int) tea.Cmd {
 	case count.BlameDoneMsg:
 		c.counts = m.Counts
 		c.sortedCountsKeyArray = m.SortedKeys
+		c.older = m.Older
+		c.newer = m.Newer
+		c.dateRange = m.DateRange
+		c.groupBy = m.GroupBy
+		c.incomplete = m.Incomplete
+		c.submodules = m.Submodules
 		if c.ready {
 			c.viewport.SetContent(c.generateContent())
 		}
@@ -175,3 +236,6 @@ func (c blameContentModel) View() string {
 	}
 	return ""
 }
+
+var outsideRangeStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("8"))
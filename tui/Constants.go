@@ -10,6 +10,10 @@ const FILETYPE_WIDTH int = 20
 const COUNT_WIDTH int = 12
 const CONTENT_TOTAL_WIDTH int = FILETYPE_WIDTH + COUNT_WIDTH
 
+// Width of the code, comment and blank columns, shown when there is room
+const KIND_WIDTH int = 9
+const KINDS_TOTAL_WIDTH int = CONTENT_TOTAL_WIDTH + 3*KIND_WIDTH
+
 type SortType int
 
 const (
@@ -0,0 +1,321 @@
+/*
+tui/DirContent.go
+
+Implements the directory tree model for the TUI.
+This model displays line counts aggregated by directory as a
+collapsible tree, with each directory's share of the total lines.
+The selected directory is broken down by filetype and author.
+It replaces the line content on the left side of the TUI when
+toggled.
+*/
+
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/go-enry/go-enry/v2"
+
+	"github.com/connorgannaway/whodunnit/count"
+)
+
+// Number of filetypes and authors shown for the selected directory
+const DIR_BREAKDOWN_LIMIT = 3
+
+type dirContentModel struct {
+	tree *count.DirNode
+	// Expanded directories by path, the root is always expanded
+	expanded map[string]bool
+	cursor   int
+	sortBy   SortType
+
+	viewport viewport.Model
+	ready    bool
+}
+
+// A visible directory and its depth in the tree
+type dirRow struct {
+	node  *count.DirNode
+	depth int
+}
+
+func newDirContentModel() dirContentModel {
+	return dirContentModel{
+		expanded: make(map[string]bool),
+		sortBy:   SortTypeAlphabetical,
+	}
+}
+
+// rows returns the directories below the root that are currently
+// visible, in display order.
+func (c dirContentModel) rows() []dirRow {
+	var rows []dirRow
+	var add func(node *count.DirNode, depth int)
+	add = func(node *count.DirNode, depth int) {
+		for _, child := range c.sortedChildren(node) {
+			rows = append(rows, dirRow{node: child, depth: depth})
+			if c.expanded[child.Path] {
+				add(child, depth+1)
+			}
+		}
+	}
+	if c.tree != nil {
+		add(c.tree, 0)
+	}
+	return rows
+}
+
+// sortedChildren returns the subdirectories of node in the current sort order.
+func (c dirContentModel) sortedChildren(node *count.DirNode) []*count.DirNode {
+	if c.sortBy != SortTypeCount {
+		return node.Children
+	}
+	children := make([]*count.DirNode, len(node.Children))
+	copy(children, node.Children)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Lines.Count > children[j].Lines.Count
+	})
+	return children
+}
+
+func (c dirContentModel) generateContent() string {
+	var content string
+
+	var vpWidth int
+	if c.ready {
+		vpWidth = c.viewport.Width
+	} else {
+		vpWidth = CONTENT_TOTAL_WIDTH
+	}
+
+	// Calculate width of directory names like LineContent.go
+	var nameColWidth int
+	if vpWidth < CONTENT_TOTAL_WIDTH {
+		nameColWidth = vpWidth - COUNT_WIDTH
+		if nameColWidth < 0 {
+			nameColWidth = 0
+		}
+	} else {
+		nameColWidth = FILETYPE_WIDTH
+	}
+
+	if c.tree == nil {
+		return lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, "Walking...")
+	}
+
+	// Generate total lines header
+	content += c.renderLine(boldText.Render(truncateString("Total:", nameColWidth)), nameColWidth,
+		boldText.Render(strconv.Itoa(c.tree.Lines.Count)), vpWidth)
+
+	for i, row := range c.rows() {
+		node := row.node
+
+		// Mark directories that can be expanded
+		marker := "  "
+		if len(node.Children) > 0 {
+			if c.expanded[node.Path] {
+				marker = "▾ "
+			} else {
+				marker = "▸ "
+			}
+		}
+		indent := ""
+		for d := 0; d < row.depth; d++ {
+			indent += "  "
+		}
+
+		name := truncateString(indent+marker+node.Name+"/", nameColWidth)
+		countStr := fmt.Sprintf("%s %5.1f%%", strconv.Itoa(node.Lines.Count), c.share(node))
+		if i == c.cursor {
+			name = selectedRow.Render(name)
+		}
+		content += c.renderLine(name, nameColWidth, countStr, vpWidth)
+
+		// Break the selected directory down by filetype and author
+		if i == c.cursor {
+			content += c.renderBreakdown(node, indent+"    ", nameColWidth, vpWidth)
+		}
+	}
+	return content
+}
+
+// share returns the percentage of the total lines in node.
+func (c dirContentModel) share(node *count.DirNode) float64 {
+	if c.tree.Lines.Count == 0 {
+		return 0
+	}
+	return float64(node.Lines.Count) * 100 / float64(c.tree.Lines.Count)
+}
+
+// renderBreakdown renders the top filetypes and authors of a directory.
+func (c dirContentModel) renderBreakdown(node *count.DirNode, indent string, nameColWidth, vpWidth int) string {
+	var content string
+	for i, k := range node.SortedTypeKeys {
+		if i == DIR_BREAKDOWN_LIMIT {
+			break
+		}
+		name := lipgloss.NewStyle().
+			Foreground(lipgloss.Color(enry.GetColor(k))).
+			Render(truncateString(indent+k, nameColWidth))
+		content += c.renderLine(name, nameColWidth, strconv.Itoa(node.LinesByType[k].Count), vpWidth)
+	}
+	for i, k := range node.SortedAuthorKeys {
+		if i == DIR_BREAKDOWN_LIMIT {
+			break
+		}
+		name := outsideRangeStyle.Render(truncateString(indent+k, nameColWidth))
+		content += c.renderLine(name, nameColWidth, strconv.Itoa(node.LinesByAuthor[k]), vpWidth)
+	}
+	return content
+}
+
+// renderLine renders a name and count column, centered in wide panels.
+func (c dirContentModel) renderLine(name string, nameColWidth int, countStr string, vpWidth int) string {
+	nameStr := lipgloss.NewStyle().
+		Align(lipgloss.Left).
+		Width(nameColWidth).
+		Render(name)
+	countStr = lipgloss.NewStyle().
+		Align(lipgloss.Right).
+		Width(COUNT_WIDTH).
+		Render(countStr)
+	line := nameStr + countStr
+	if vpWidth > CONTENT_TOTAL_WIDTH {
+		line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+	}
+	return line + "\n"
+}
+
+// moveCursor moves the selection by delta rows and scrolls it into view.
+func (c *dirContentModel) moveCursor(delta int) {
+	rows := c.rows()
+	c.cursor += delta
+	if c.cursor >= len(rows) {
+		c.cursor = len(rows) - 1
+	}
+	if c.cursor < 0 {
+		c.cursor = 0
+	}
+	c.refresh()
+
+	// The total line comes before the first row
+	line := c.cursor + 1
+	if line < c.viewport.YOffset {
+		c.viewport.SetYOffset(line)
+	} else if line >= c.viewport.YOffset+c.viewport.Height {
+		c.viewport.SetYOffset(line - c.viewport.Height + 1)
+	}
+}
+
+// toggle expands or collapses the selected directory.
+func (c *dirContentModel) toggle() {
+	rows := c.rows()
+	if c.cursor >= len(rows) {
+		return
+	}
+	node := rows[c.cursor].node
+	if len(node.Children) > 0 {
+		c.expanded[node.Path] = !c.expanded[node.Path]
+	}
+	c.refresh()
+}
+
+// setAllExpanded expands or collapses every directory.
+func (c *dirContentModel) setAllExpanded(expanded bool) {
+	// Keep the selected directory selected after collapsing
+	var selected string
+	if rows := c.rows(); c.cursor < len(rows) {
+		selected = rows[c.cursor].node.Path
+	}
+
+	c.expanded = make(map[string]bool)
+	if expanded && c.tree != nil {
+		var expand func(node *count.DirNode)
+		expand = func(node *count.DirNode) {
+			for _, child := range node.Children {
+				if len(child.Children) > 0 {
+					c.expanded[child.Path] = true
+					expand(child)
+				}
+			}
+		}
+		expand(c.tree)
+	}
+
+	c.cursor = 0
+	for i, row := range c.rows() {
+		if row.node.Path == selected {
+			c.cursor = i
+		}
+	}
+	c.moveCursor(0)
+}
+
+func (c *dirContentModel) refresh() {
+	if c.ready {
+		c.viewport.SetContent(c.generateContent())
+	}
+}
+
+func (c *dirContentModel) Update(msg tea.Msg, width, height int) tea.Cmd {
+	var cmds []tea.Cmd
+
+	switch m := msg.(type) {
+	case count.WalkDoneMsg:
+		c.tree = m.Tree
+		c.moveCursor(0)
+	case count.BlameDoneMsg:
+		c.tree = m.Tree
+		c.moveCursor(0)
+	case tea.KeyMsg:
+		// Tree navigation keys don't scroll the viewport
+		switch m.String() {
+		case "up", "k":
+			c.moveCursor(-1)
+			return nil
+		case "down", "j":
+			c.moveCursor(1)
+			return nil
+		case "enter", " ":
+			c.toggle()
+			return nil
+		case "+":
+			c.setAllExpanded(true)
+			return nil
+		case "-":
+			c.setAllExpanded(false)
+			return nil
+		}
+	case tea.WindowSizeMsg:
+		if !c.ready {
+			c.viewport = viewport.New(width, height)
+			c.viewport.SetContent(c.generateContent())
+			c.ready = true
+		} else {
+			c.viewport.Width = width
+			c.viewport.Height = height
+			c.viewport.SetContent(c.generateContent())
+		}
+	}
+
+	// Also pass the message to the viewport
+	var vpCmd tea.Cmd
+	c.viewport, vpCmd = c.viewport.Update(msg)
+	cmds = append(cmds, vpCmd)
+
+	return tea.Batch(cmds...)
+}
+
+func (c dirContentModel) View() string {
+	if c.ready {
+		return c.viewport.View()
+	}
+	return ""
+}
+
+var selectedRow = lipgloss.NewStyle().Reverse(true)
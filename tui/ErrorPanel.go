@@ -0,0 +1,76 @@
+/*
+tui/ErrorPanel.go
+
+Implements the error panel model for the TUI.
+Lists the files and directories the walk couldn't read. It is shown
+in place of the content panels once the walk finishes with failures,
+until dismissed.
+*/
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/connorgannaway/whodunnit/count"
+)
+
+type errorPanelModel struct {
+	root      string
+	errors    []count.FileError
+	dismissed bool
+}
+
+func newErrorPanelModel(root string) errorPanelModel {
+	return errorPanelModel{root: root}
+}
+
+// Visible reports whether there are failures that haven't been dismissed.
+func (e errorPanelModel) Visible() bool {
+	return len(e.errors) > 0 && !e.dismissed
+}
+
+func (e *errorPanelModel) Update(msg tea.Msg) {
+	switch m := msg.(type) {
+	case count.WalkDoneMsg:
+		e.errors = m.Errors
+		e.dismissed = false
+	case tea.KeyMsg:
+		if e.Visible() && m.String() == "x" {
+			e.dismissed = true
+		}
+	}
+}
+
+func (e errorPanelModel) View(width, height int) string {
+	// Leave room for the border, title and hint
+	innerWidth := width - errorPanelStyle.GetHorizontalFrameSize()
+	maxLines := height - errorPanelStyle.GetVerticalFrameSize() - 4
+	if innerWidth < 4 || maxLines < 1 {
+		return ""
+	}
+
+	title := boldText.Render(fmt.Sprintf("%d files or directories could not be read", len(e.errors)))
+	lines := []string{title, ""}
+	for i, fe := range e.errors {
+		if i == maxLines {
+			lines = append(lines, outsideRangeStyle.Render(fmt.Sprintf("...and %d more", len(e.errors)-i)))
+			break
+		}
+		path, _ := strings.CutPrefix(fe.Path, e.root+"/")
+		lines = append(lines, truncateString(fmt.Sprintf("[%s] %s: %s", fe.Phase, path, fe.Message), innerWidth))
+	}
+	lines = append(lines, "", footerBold.Render("x")+" "+footerText.Render("Dismiss"))
+
+	return errorPanelStyle.
+		Width(width - errorPanelStyle.GetHorizontalBorderSize()).
+		Render(strings.Join(lines, "\n"))
+}
+
+var errorPanelStyle = lipgloss.NewStyle().
+	Border(lipgloss.RoundedBorder()).
+	BorderForeground(lipgloss.Color("1")).
+	Padding(0, 1)
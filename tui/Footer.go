@@ -3,7 +3,9 @@ tui/Footer.go
 
 Implements the footer model for the TUI.
 This displays the current applicable controls for the TUI
-and the latest received status message.
+and the latest received status message, or once blaming is done
+how much of the repo was blamed. It also hosts the input used to
+change the blame date range.
 */
 
 package tui
@@ -12,6 +14,7 @@ import (
 	"fmt"
 
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/connorgannaway/whodunnit/count"
@@ -21,26 +24,39 @@ type control struct {
 	key, desc string
 }
 
+const rangePlaceholder = "YYYY-MM-DD..YYYY-MM-DD"
+
 type footerModel struct {
 	width      int
 	controls   []control
 	controlsLR []control
 	separator  string
 	status     string
+	summary    string // Blame coverage, shown once blaming is done
 	showLR     bool
 	spinner    spinner.Model
+
+	rangeInput   textinput.Model
+	editingRange bool
 }
 
 func newFooterModel() footerModel {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	ri := textinput.New()
+	ri.Prompt = "Date range: "
+	ri.Placeholder = rangePlaceholder
 	return footerModel{
 		// Displayed controls at normal width
 		controls: []control{
 			{key: "↑", desc: "Move Up"},
 			{key: "↓", desc: "Move Down"},
 			{key: "s", desc: "Change Sort"},
+			{key: "t", desc: "Tree"},
+			{key: "d", desc: "Date Range"},
+			{key: "g", desc: "Group By"},
+			{key: "r", desc: "Rescan"},
 			{key: "q", desc: "Quit"},
 		},
 		// Displayed controls at narrow width
@@ -49,12 +65,44 @@ func newFooterModel() footerModel {
 			{key: "↓", desc: "Move Down"},
 			{key: "←/→", desc: "Switch Panels"},
 			{key: "s", desc: "Change Sort"},
+			{key: "t", desc: "Tree"},
+			{key: "d", desc: "Date Range"},
+			{key: "g", desc: "Group By"},
+			{key: "r", desc: "Rescan"},
 			{key: "q", desc: "Quit"},
 		},
-		separator: " | ",
-		status:    "Walking directory...", // Pre-load walking status
-		spinner:   s,
+		separator:  " | ",
+		status:     "Walking directory...", // Pre-load walking status
+		spinner:    s,
+		rangeInput: ri,
+	}
+}
+
+// Add a control, shown before the rescan and quit controls
+func (f *footerModel) addControl(c control) {
+	for _, controls := range []*[]control{&f.controls, &f.controlsLR} {
+		i := len(*controls) - 2
+		*controls = append((*controls)[:i], append([]control{c}, (*controls)[i:]...)...)
+	}
+}
+
+// Focus the date range input, pre-filled with the current range
+func (f *footerModel) startRangeInput(current count.DateRange) tea.Cmd {
+	f.editingRange = true
+	f.rangeInput.Placeholder = rangePlaceholder
+	if current.IsZero() {
+		f.rangeInput.SetValue("")
+	} else {
+		f.rangeInput.SetValue(current.String())
 	}
+	f.rangeInput.CursorEnd()
+	return f.rangeInput.Focus()
+}
+
+// Unfocus and hide the date range input
+func (f *footerModel) stopRangeInput() {
+	f.editingRange = false
+	f.rangeInput.Blur()
 }
 
 func (f *footerModel) Init() tea.Cmd {
@@ -63,11 +111,31 @@ func (f *footerModel) Init() tea.Cmd {
 
 func (f *footerModel) Update(msg tea.Msg, width int) tea.Cmd {
 	var cmds []tea.Cmd
+
+	// Keep the cursor blinking while the date range input is open
+	if f.editingRange {
+		if _, ok := msg.(tea.KeyMsg); !ok {
+			var cmd tea.Cmd
+			f.rangeInput, cmd = f.rangeInput.Update(msg)
+			cmds = append(cmds, cmd)
+		}
+	}
+
 	switch m := msg.(type) {
 	case count.BlameStatusMsg:
 		f.status = fmt.Sprintf("Blaming (%d / %d): %s", m.CurrentFile, m.TotalFiles, m.Filepath)
 	case count.BlameDoneMsg:
 		f.status = ""
+		f.summary = fmt.Sprintf("Blamed %.1f%% of lines", m.Coverage*100)
+		if len(m.Failures) > 0 {
+			f.summary += fmt.Sprintf(", %d files could not be blamed", len(m.Failures))
+		}
+	case tea.KeyMsg:
+		if f.editingRange {
+			var cmd tea.Cmd
+			f.rangeInput, cmd = f.rangeInput.Update(msg)
+			return cmd
+		}
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		f.spinner, cmd = f.spinner.Update(msg)
@@ -108,8 +176,12 @@ func (f footerModel) View() string {
 		}
 	}
 	statusLine := ""
-	if f.status != "" {
+	if f.editingRange {
+		statusLine = f.rangeInput.View()
+	} else if f.status != "" {
 		statusLine = f.spinner.View() + " " + f.status
+	} else if f.summary != "" {
+		statusLine = footerText.Render(f.summary)
 	}
 	return lipgloss.PlaceHorizontal(f.width, lipgloss.Center, s) + "\n" + statusLine
 }
@@ -3,18 +3,22 @@ tui/Header.go
 
 Implements the header model for the TUI.
 Displays the target directory name, git information if
-applicable, and the active panel indicator if applicable.
+applicable, the scanned path within the repository when a
+subdirectory is scanned, and the active panel indicator if applicable.
+For batch scans it displays the batch name and the shown repository.
 */
 
 package tui
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/connorgannaway/whodunnit/count"
 	"github.com/go-git/go-git/v5"
 )
 
@@ -34,6 +38,10 @@ func SetActivePanel(panel int) tea.Cmd {
 type headerModel struct {
 	path          string
 	directoryName string
+	// Path of the scanned directory within the repository, "" for its root
+	subPath string
+	// Shown in place of the git information outside of a repository
+	note          string
 	isGitRepo     bool
 	currentBranch string
 	hash          string
@@ -41,8 +49,9 @@ type headerModel struct {
 	activePanel   int
 }
 
-// Create a new header model
-func newHeaderModel(path string) headerModel {
+// Create a new header model. If rev is set, the header shows it
+// in place of the current branch.
+func newHeaderModel(path, rev string) headerModel {
 	// evaluate the path
 	cleanPath := filepath.Clean(path)
 	absPath, err := filepath.Abs(cleanPath)
@@ -64,19 +73,19 @@ func newHeaderModel(path string) headerModel {
 	var isGitRepo bool = false
 	var currentBranch string = ""
 	var hash string = ""
-	repo, err := git.PlainOpen(path)
+	var subPath string = ""
+	repo, repoRoot, prefix, err := count.OpenRepo(path)
 	if err == nil {
-		headRef, err := repo.Head()
-		if err == nil {
-			currentBranch = headRef.Name().Short()
-			hash = headRef.Hash().String()[0:7]
-			isGitRepo = true
-		}
+		// Name the repository, even when scanning a subdirectory of it
+		d = filepath.Base(repoRoot)
+		subPath = prefix
+		currentBranch, hash, isGitRepo = repoHead(repo, rev)
 	}
 
 	return headerModel{
 		path:          absPath,
 		directoryName: d,
+		subPath:       subPath,
 		isGitRepo:     isGitRepo,
 		currentBranch: currentBranch,
 		hash:          hash,
@@ -84,6 +93,65 @@ func newHeaderModel(path string) headerModel {
 	}
 }
 
+// Create a header model for a repository cloned from url, which
+// isn't on disk and is named after the url.
+func newRepoHeaderModel(repo *git.Repository, url, rev string) headerModel {
+	name := count.RepoName(url)
+	currentBranch, hash, isGitRepo := repoHead(repo, rev)
+	return headerModel{
+		path:          name,
+		directoryName: name,
+		isGitRepo:     isGitRepo,
+		currentBranch: currentBranch,
+		hash:          hash,
+		activePanel:   0,
+	}
+}
+
+// Create a header model for a batch, named after its directory or list
+func newBatchHeaderModel(batch *count.Batch) headerModel {
+	return headerModel{
+		path:          batch.Name,
+		directoryName: batch.Name,
+		note:          fmt.Sprintf("%d repositories", len(batch.Repos)),
+		activePanel:   0,
+	}
+}
+
+// Show repo of the batch, or every repository if it is nil
+func (h *headerModel) showRepo(repo *count.BatchRepo, total int) {
+	h.subPath = ""
+	h.note = fmt.Sprintf("%d repositories", total)
+	h.isGitRepo = false
+	if repo == nil {
+		return
+	}
+	h.subPath = repo.Name
+	h.note = ""
+	if repo.Commit != "" {
+		h.isGitRepo = true
+		h.currentBranch = repo.Branch
+		h.hash = repo.Commit[0:7]
+	}
+}
+
+// repoHead returns the branch name and abbreviated hash of the commit
+// shown for repo, rev if it is set and HEAD otherwise.
+func repoHead(repo *git.Repository, rev string) (branch, hash string, ok bool) {
+	if rev != "" {
+		commit, err := count.ResolveCommit(repo, rev)
+		if err != nil {
+			return "", "", false
+		}
+		return rev, commit.Hash.String()[0:7], true
+	}
+	headRef, err := repo.Head()
+	if err != nil {
+		return "", "", false
+	}
+	return headRef.Name().Short(), headRef.Hash().String()[0:7], true
+}
+
 // Header update function
 func (h *headerModel) Update(msg tea.Msg, width int) tea.Cmd {
 	var cmds []tea.Cmd
@@ -103,6 +171,9 @@ func (h *headerModel) Update(msg tea.Msg, width int) tea.Cmd {
 func (h headerModel) View() string {
 	// Create git information string
 	gitString := ""
+	if h.note != "" {
+		gitString = " " + hashStyle.Render(h.note) + " "
+	}
 	if h.isGitRepo {
 		gitString = gitStyle.String() + boldText.Render(h.currentBranch) + " "
 		if h.hash != "" {
@@ -111,7 +182,11 @@ func (h headerModel) View() string {
 	}
 
 	// Create directory name with box
-	dirBox := directoryStyle.Render(h.directoryName)
+	dirName := h.directoryName
+	if h.subPath != "" {
+		dirName += hashStyle.Render("/" + h.subPath)
+	}
+	dirBox := directoryStyle.Render(dirName)
 	preGitInfo := "──"
 
 	// Create dot string
@@ -3,15 +3,19 @@ tui/JsonExport/JsonExport.go
 
 JsonExport provides functionality to export the data collected by the
 application in JSON format separate to the TUI. It drives the file walk
-and blame process and assembles the data into a JSON structure.
+and blame process and assembles the data into a JSON structure, or
+streams the blamed line ranges as newline delimited JSON.
 */
 
 package JsonExport
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
 
 	"github.com/connorgannaway/whodunnit/count"
 	"github.com/go-git/go-git/v5"
@@ -19,33 +23,244 @@ import (
 
 type jsonExportBody struct {
 	IgnoredFileTypes count.IgnoreConfig
+	Options          count.Options
+	jsonResult
+}
+
+// Counts and blame of a scan, shared by the export of a directory,
+// each repository of a batch and each submodule
+type jsonResult struct {
+	TotalLines    int
+	Totals        count.FileCount
+	IncludedFiles []count.ValidFile
+	FileCounts    map[string]count.FileCount
+	Blame         map[string]*count.BlameCount
+	// Line and blame counts by directory
+	Tree *count.DirNode
+	// Entries that couldn't be counted, such as symlinks and named pipes
+	Skipped []count.SkippedEntry
+	// Files and directories that couldn't be read
+	Errors []count.FileError
+	// Counted files that couldn't be blamed, and the share of
+	// counted lines that were blamed
+	BlameFailures []count.BlameFailure
+	BlamedLines   int
+	BlameCoverage float64
+	// Lines changed outside Options.DateRange
+	BlameOlder *count.BlameCount `json:",omitempty"`
+	BlameNewer *count.BlameCount `json:",omitempty"`
+	// Submodules counted and blamed on their own, not included in
+	// the counts above
+	Submodules []jsonSubmodule `json:",omitempty"`
+	// The scan timed out, so only some files are counted and blamed
+	Incomplete bool
+}
+
+// Counts and blame of a submodule scanned on its own
+type jsonSubmodule struct {
+	Name   string
+	Path   string
+	Commit string
+	jsonResult
+}
+
+// Counts of every repository of a batch together, followed by the
+// counts of each one
+type jsonBatchBody struct {
+	IgnoredFileTypes count.IgnoreConfig
+	Options          count.Options
 	TotalLines       int
-	IncludedFiles    []count.ValidFile
+	Totals           count.FileCount
 	FileCounts       map[string]count.FileCount
 	Blame            map[string]*count.BlameCount
+	// Line and blame counts by directory, one per repository at the top
+	Tree          *count.DirNode
+	BlameFailures []count.BlameFailure
+	BlamedLines   int
+	BlameCoverage float64
+	BlameOlder    *count.BlameCount `json:",omitempty"`
+	BlameNewer    *count.BlameCount `json:",omitempty"`
+	Repositories  []jsonRepository
+	// The batch timed out before every repository was scanned
+	Incomplete bool
+}
+
+// Counts and blame of a single repository of a batch
+type jsonRepository struct {
+	Name   string
+	Path   string
+	Branch string
+	Commit string
+	// Why the repository couldn't be scanned, in which case it has
+	// no counts
+	Error string `json:",omitempty"`
+	jsonResult
 }
 
 // ExportJSON returns a JSON representation of the data collected by the
-// application. It handles the file walk and blame process
-func ExportJSON(rootfs string, cfg count.IgnoreConfig) ([]byte, error) {
-	walkMsg := count.Walk(rootfs, cfg)
-	if errMsg, ok := walkMsg.(count.WalkErrorMsg); ok {
-		return nil, fmt.Errorf("walk error: %w", errMsg.Err)
+// application. It handles the file walk and blame process. If the scan
+// times out, the partial results are exported and marked incomplete.
+func ExportJSON(ctx context.Context, rootfs string, cfg count.IgnoreConfig, opts count.Options) ([]byte, error) {
+	return ExportScannerJSON(ctx, count.NewScanner(rootfs, cfg, opts), cfg, opts)
+}
+
+// ExportScannerJSON is ExportJSON for a scanner created by the caller,
+// such as one for a cloned repository. cfg and opts must be the ones
+// the scanner was created with.
+func ExportScannerJSON(ctx context.Context, scanner *count.Scanner, cfg count.IgnoreConfig, opts count.Options) ([]byte, error) {
+	ctx, cancel := opts.Context(ctx)
+	defer cancel()
+
+	res, err := scanner.Walk(ctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("walk error: %w", err)
 	}
 
-	blameMsg := count.StartBlameRepo(rootfs)()
-	if errMsg, ok := blameMsg.(count.BlameErrorMsg); ok {
-		if !errors.Is(errMsg.Err, git.ErrRepositoryNotExists) {
-			return nil, fmt.Errorf("blame error: %w", errMsg.Err)
+	if err := scanner.Blame(ctx, res); err != nil {
+		if !errors.Is(err, git.ErrRepositoryNotExists) && !errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("blame error: %w", err)
 		}
 	}
 
-	body := jsonExportBody{
+	return json.Marshal(newJsonExportBody(cfg, opts, res))
+}
+
+// ExportBatchJSON returns a JSON representation of every repository of
+// the batch, created with cfg and opts, and of their aggregate. If the
+// batch times out, the repositories scanned so far are exported and
+// the batch is marked incomplete.
+func ExportBatchJSON(ctx context.Context, batch *count.Batch, cfg count.IgnoreConfig, opts count.Options) ([]byte, error) {
+	ctx, cancel := opts.Context(ctx)
+	defer cancel()
+
+	if err := batch.Scan(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("batch error: %w", err)
+	}
+
+	agg := batch.Aggregate
+	body := jsonBatchBody{
 		IgnoredFileTypes: cfg,
-		IncludedFiles:    count.Files,
-		TotalLines:       count.TotalLines,
-		FileCounts:       count.Counts,
-		Blame:            count.BlameCounts,
+		Options:          opts,
+		TotalLines:       agg.TotalLines,
+		Totals:           agg.Totals,
+		FileCounts:       agg.Counts,
+		Blame:            agg.BlameCounts,
+		Tree:             agg.Tree,
+		BlameFailures:    agg.BlameFailures,
+		BlamedLines:      agg.BlamedLines,
+		BlameCoverage:    agg.BlameCoverage(),
+		BlameOlder:       agg.BlameOlder,
+		BlameNewer:       agg.BlameNewer,
+		Incomplete:       agg.Incomplete,
+	}
+	for _, repo := range batch.Repos {
+		body.Repositories = append(body.Repositories, newJsonRepository(repo))
 	}
 	return json.Marshal(body)
 }
+
+// ExportLineRanges walks and blames the scanner's files, writing every
+// blamed line range to w as soon as it is produced, one JSON object per
+// line. Nothing is buffered, so the output can be consumed while the
+// scan is running. If writing fails the scan is stopped. If it times
+// out, the ranges written so far are kept.
+func ExportLineRanges(ctx context.Context, scanner *count.Scanner, opts count.Options, w io.Writer) error {
+	ctx, cancel := opts.Context(ctx)
+	defer cancel()
+
+	// Blame workers report ranges concurrently
+	var mu sync.Mutex
+	var writeErr error
+	enc := json.NewEncoder(w)
+	scanner.OnLineRange(func(lr count.LineRange) {
+		mu.Lock()
+		defer mu.Unlock()
+		if writeErr != nil {
+			return
+		}
+		if err := enc.Encode(lr); err != nil {
+			writeErr = err
+			cancel()
+		}
+	})
+	defer scanner.OnLineRange(nil)
+
+	res, err := scanner.Walk(ctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("walk error: %w", err)
+	}
+	err = scanner.Blame(ctx, res)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if writeErr != nil {
+		return fmt.Errorf("write error: %w", writeErr)
+	}
+	if err != nil && !errors.Is(err, git.ErrRepositoryNotExists) && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("blame error: %w", err)
+	}
+	return nil
+}
+
+// newJsonExportBody assembles the exported data from a scan result.
+func newJsonExportBody(cfg count.IgnoreConfig, opts count.Options, res *count.Result) jsonExportBody {
+	return jsonExportBody{
+		IgnoredFileTypes: cfg,
+		Options:          opts,
+		jsonResult:       newJsonResult(res),
+	}
+}
+
+// newJsonResult assembles the counts and blame of a scan result. A nil
+// result, of a repository that couldn't be scanned, has no counts.
+func newJsonResult(res *count.Result) jsonResult {
+	if res == nil {
+		return jsonResult{}
+	}
+	return jsonResult{
+		TotalLines:    res.TotalLines,
+		Totals:        res.Totals,
+		IncludedFiles: res.Files,
+		FileCounts:    res.Counts,
+		Blame:         res.BlameCounts,
+		Tree:          res.Tree,
+		Skipped:       res.Skipped,
+		Errors:        res.Errors,
+		BlameFailures: res.BlameFailures,
+		BlamedLines:   res.BlamedLines,
+		BlameCoverage: res.BlameCoverage(),
+		BlameOlder:    res.BlameOlder,
+		BlameNewer:    res.BlameNewer,
+		Submodules:    newJsonSubmodules(res.Submodules),
+		Incomplete:    res.Incomplete,
+	}
+}
+
+// newJsonRepository assembles the exported data of a repository of a batch.
+func newJsonRepository(repo *count.BatchRepo) jsonRepository {
+	jr := jsonRepository{
+		Name:       repo.Name,
+		Path:       repo.Target,
+		Branch:     repo.Branch,
+		Commit:     repo.Commit,
+		jsonResult: newJsonResult(repo.Result),
+	}
+	if repo.Err != nil {
+		jr.Error = repo.Err.Error()
+	}
+	return jr
+}
+
+// newJsonSubmodules assembles the exported data of each submodule.
+func newJsonSubmodules(subs []*count.SubmoduleResult) []jsonSubmodule {
+	var out []jsonSubmodule
+	for _, sub := range subs {
+		out = append(out, jsonSubmodule{
+			Name:       sub.Name,
+			Path:       sub.Path,
+			Commit:     sub.Commit,
+			jsonResult: newJsonResult(sub.Result),
+		})
+	}
+	return out
+}
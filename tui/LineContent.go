@@ -3,8 +3,10 @@ tui/LineContent.go
 
 Implements the line content model for the TUI.
 This model displays filetype line counts in the current
-sort order. This is rendered in a viewport on the left side
-of the TUI.
+sort order, split into code, comment and blank lines when the
+panel is wide enough, followed by the totals of submodules
+counted on their own. This is rendered in a viewport on the left
+side of the TUI.
 */
 
 package tui
@@ -26,6 +28,9 @@ type lineContentModel struct {
 	sortedCountsKeys       []string
 	sortBy                 SortType
 	totalLines             int
+	totals                 count.FileCount
+	skipped                int
+	submodules             []*count.SubmoduleResult
 
 	viewport viewport.Model
 	ready    bool
@@ -65,6 +70,25 @@ func (c lineContentModel) generateContent() string {
 		filetypeColWidth = FILETYPE_WIDTH
 	}
 
+	// Only split lines by kind if the extra columns fit
+	showKinds := vpWidth >= KINDS_TOTAL_WIDTH
+	lineWidth := CONTENT_TOTAL_WIDTH
+	if showKinds {
+		lineWidth = KINDS_TOTAL_WIDTH
+	}
+
+	var line string
+	if showKinds {
+		// Label the kind columns
+		line = lipgloss.NewStyle().Width(filetypeColWidth).Render("") +
+			kindColumns(lipgloss.NewStyle().Faint(true), "Code", "Comment", "Blank") +
+			lipgloss.NewStyle().Faint(true).Align(lipgloss.Right).Width(COUNT_WIDTH).Render("Lines")
+		if vpWidth > lineWidth {
+			line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+		}
+		content += line + "\n"
+	}
+
 	// Generate total lines header
 	totalLabel := lipgloss.NewStyle().
 		Align(lipgloss.Left).
@@ -76,8 +100,13 @@ func (c lineContentModel) generateContent() string {
 		Width(COUNT_WIDTH).
 		Bold(true).
 		Render(strconv.Itoa(c.totalLines))
-	line := totalLabel + totalCount
-	if vpWidth > CONTENT_TOTAL_WIDTH {
+	line = totalLabel
+	if showKinds {
+		line += kindColumns(lipgloss.NewStyle().Bold(true),
+			strconv.Itoa(c.totals.Code), strconv.Itoa(c.totals.Comment), strconv.Itoa(c.totals.Blank))
+	}
+	line += totalCount
+	if vpWidth > lineWidth {
 		line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
 	}
 	content += line + "\n"
@@ -104,15 +133,64 @@ func (c lineContentModel) generateContent() string {
 			Align(lipgloss.Right).
 			Width(COUNT_WIDTH).
 			Render(strconv.Itoa(v.Count))
-		line = filetypeStr + countStr
-		if vpWidth > CONTENT_TOTAL_WIDTH {
+		line = filetypeStr
+		if showKinds {
+			line += kindColumns(lipgloss.NewStyle(),
+				strconv.Itoa(v.Code), strconv.Itoa(v.Comment), strconv.Itoa(v.Blank))
+		}
+		line += countStr
+		if vpWidth > lineWidth {
 			line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
 		}
 		content += line + "\n"
 	}
+
+	// Submodules scanned on their own are grouped separately
+	if len(c.submodules) > 0 {
+		line = lipgloss.NewStyle().
+			Align(lipgloss.Left).
+			Width(min(lineWidth, vpWidth)).
+			Bold(true).
+			Render("Submodules:")
+		if vpWidth > lineWidth {
+			line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+		}
+		content += "\n" + line + "\n"
+	}
+	for _, sub := range c.submodules {
+		totals := sub.Result.Totals
+		line = lipgloss.NewStyle().
+			Align(lipgloss.Left).
+			Width(filetypeColWidth).
+			Render(truncateString(sub.Path, filetypeColWidth))
+		if showKinds {
+			line += kindColumns(lipgloss.NewStyle(),
+				strconv.Itoa(totals.Code), strconv.Itoa(totals.Comment), strconv.Itoa(totals.Blank))
+		}
+		line += lipgloss.NewStyle().
+			Align(lipgloss.Right).
+			Width(COUNT_WIDTH).
+			Render(strconv.Itoa(totals.Count))
+		if vpWidth > lineWidth {
+			line = lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line)
+		}
+		content += line + "\n"
+	}
+
+	// Note entries like symlinks and named pipes that weren't counted
+	if c.skipped > 0 {
+		line = outsideRangeStyle.Render(strconv.Itoa(c.skipped) + " entries skipped")
+		content += "\n" + lipgloss.PlaceHorizontal(vpWidth, lipgloss.Center, line) + "\n"
+	}
 	return content
 }
 
+// kindColumns renders the code, comment and blank columns.
+func kindColumns(style lipgloss.Style, code, comment, blank string) string {
+	column := style.Align(lipgloss.Right).Width(KIND_WIDTH)
+	return column.Render(code) + column.Render(comment) + column.Render(blank)
+}
+
 func (c *lineContentModel) Update(msg tea.Msg, width, height int) tea.Cmd {
 	var cmds []tea.Cmd
 
@@ -122,6 +200,9 @@ func (c *lineContentModel) Update(msg tea.Msg, width, height int) tea.Cmd {
 		c.sortedAlphabeticalKeys = m.SortedAlphabeticalKeys
 		c.sortedCountsKeys = m.SortedCountsKeys
 		c.totalLines = m.TotalLines
+		c.totals = m.Totals
+		c.skipped = len(m.Skipped)
+		c.submodules = m.Submodules
 		if c.ready {
 			c.viewport.SetContent(c.generateContent())
 		}
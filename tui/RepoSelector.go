@@ -0,0 +1,127 @@
+/*
+tui/RepoSelector.go
+
+Implements the repository selector for batch scans.
+Lists the aggregate of all repositories followed by each repository
+with its line count, or how far its scan got. It is shown in place of
+the content panels while open, and picking an entry shows its counts
+and blame in the panels.
+*/
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/connorgannaway/whodunnit/count"
+)
+
+type repoSelectorModel struct {
+	batch   *count.Batch
+	visible bool
+	// Highlighted entry and the one shown in the panels, 0 for the
+	// aggregate and i+1 for the i-th repository
+	cursor   int
+	selected int
+	// Repository being scanned, len(batch.Repos) once the batch is done
+	scanning int
+}
+
+func newRepoSelectorModel(batch *count.Batch) repoSelectorModel {
+	return repoSelectorModel{batch: batch}
+}
+
+// Done reports whether every repository was scanned.
+func (s repoSelectorModel) Done() bool {
+	return s.scanning >= len(s.batch.Repos)
+}
+
+// Move the cursor by delta entries, stopping at either end
+func (s *repoSelectorModel) moveCursor(delta int) {
+	s.cursor = max(0, min(len(s.batch.Repos), s.cursor+delta))
+}
+
+// result returns the result of entry i, nil if it has none to show.
+func (s repoSelectorModel) result(i int) *count.Result {
+	if i == 0 {
+		return s.batch.Aggregate
+	}
+	return s.batch.Repos[i-1].Result
+}
+
+func (s repoSelectorModel) View(width, height int) string {
+	// Leave room for the border, title and hint
+	innerWidth := width - repoSelectorStyle.GetHorizontalFrameSize()
+	maxLines := height - repoSelectorStyle.GetVerticalFrameSize() - 4
+	if innerWidth < 4 || maxLines < 1 {
+		return ""
+	}
+
+	title := boldText.Render(fmt.Sprintf("%d repositories in %s", len(s.batch.Repos), s.batch.Name))
+	lines := []string{title, ""}
+
+	// Keep the cursor in view, scrolling the list a page at a time
+	first := s.cursor / maxLines * maxLines
+	for i := first; i <= len(s.batch.Repos) && i < first+maxLines; i++ {
+		name, status := s.entry(i)
+		status = truncateString(status, max(4, innerWidth/2))
+		statusWidth := lipgloss.Width(status)
+		line := truncateString(name, max(4, innerWidth-statusWidth-1))
+		line += strings.Repeat(" ", max(1, innerWidth-lipgloss.Width(line)-statusWidth)) + status
+
+		switch {
+		case i == s.cursor:
+			line = selectedRow.Render(line)
+		case s.result(i) == nil:
+			line = outsideRangeStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+
+	hint := footerBold.Render("↑/↓") + " " + footerText.Render("Move") +
+		footerSeparator.Render(" | ") + footerBold.Render("enter") + " " + footerText.Render("Show") +
+		footerSeparator.Render(" | ") + footerBold.Render("p") + " " + footerText.Render("Close")
+	lines = append(lines, "", hint)
+
+	return repoSelectorStyle.
+		Width(width - repoSelectorStyle.GetHorizontalBorderSize()).
+		Render(strings.Join(lines, "\n"))
+}
+
+// entry returns the label and status of entry i.
+func (s repoSelectorModel) entry(i int) (name, status string) {
+	marker := "  "
+	if i == s.selected && s.Done() {
+		marker = "• "
+	}
+	if i == 0 {
+		if !s.Done() {
+			return marker + "All repositories", "waiting"
+		}
+		return marker + "All repositories", fmt.Sprintf("%d lines", s.batch.Aggregate.TotalLines)
+	}
+
+	repo := s.batch.Repos[i-1]
+	switch {
+	case repo.Err != nil:
+		status = "failed: " + repo.Err.Error()
+	case repo.Result != nil:
+		status = fmt.Sprintf("%d lines", repo.Result.TotalLines)
+		if repo.Result.Incomplete {
+			status += " (incomplete)"
+		}
+	case i-1 == s.scanning:
+		status = "scanning"
+	case s.Done():
+		status = "not scanned"
+	default:
+		status = "waiting"
+	}
+	return marker + repo.Name, status
+}
+
+var repoSelectorStyle = lipgloss.NewStyle().
+	Border(lipgloss.RoundedBorder()).
+	Padding(0, 1)
@@ -12,6 +12,7 @@ the sorting of the content based on user input.
 package tui
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -25,8 +26,10 @@ import (
 type rootModel struct {
 	header       headerModel
 	lineContent  lineContentModel
+	dirContent   dirContentModel
 	blameContent blameContentModel
 	footer       footerModel
+	errorPanel   errorPanelModel
 	errors       []error
 
 	windowWidth   int
@@ -36,67 +39,295 @@ type rootModel struct {
 	headerHeight  int
 
 	activePanel int
+	blameDone   bool
+	// Show the directory tree in place of the line content
+	showTree bool
 
-	sortBy           SortType
-	fileIgnoreConfig count.IgnoreConfig
+	sortBy  SortType
+	options count.Options
+	ignore  count.IgnoreConfig
+	scanner *count.Scanner
+	result  *count.Result
+	// Repositories scanned one after the other, nil outside batch mode
+	batch    *count.Batch
+	selector repoSelectorModel
+
+	// Cancels the in-flight walk and blame
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewRootModel(rootfs string, ign *count.IgnoreConfig, opts count.Options) rootModel {
+	ignoreCfg := ignoreConfigOrDefault(ign)
+	header := newHeaderModel(rootfs, opts.Rev)
+	return newRootModel(header, count.NewScanner(header.path, ignoreCfg, opts), ignoreCfg, opts)
+}
+
+// NewClonedRootModel creates the root model for a repository cloned
+// into memory from url, see count.CloneRepo.
+func NewClonedRootModel(repo *git.Repository, url string, ign *count.IgnoreConfig, opts count.Options) rootModel {
+	ignoreCfg := ignoreConfigOrDefault(ign)
+	header := newRepoHeaderModel(repo, url, opts.Rev)
+	return newRootModel(header, count.NewRepoScanner(repo, header.path, ignoreCfg, opts), ignoreCfg, opts)
+}
+
+// NewBatchRootModel creates the root model for a batch of repositories,
+// see count.NewBatch.
+func NewBatchRootModel(batch *count.Batch, ign *count.IgnoreConfig, opts count.Options) rootModel {
+	ignoreCfg := ignoreConfigOrDefault(ign)
+	r := newRootModel(newBatchHeaderModel(batch), nil, ignoreCfg, opts)
+	r.batch = batch
+	r.selector = newRepoSelectorModel(batch)
+	r.footer.addControl(control{key: "p", desc: "Repos"})
+	r.footer.status = fmt.Sprintf("Scanning %s (1 / %d)...", batch.Repos[0].Name, len(batch.Repos))
+	r.header.showRepo(batch.Repos[0], len(batch.Repos))
+	return r
 }
 
-func NewRootModel(rootfs string, ign *count.IgnoreConfig) rootModel {
-	var ignoreCfg count.IgnoreConfig
+func ignoreConfigOrDefault(ign *count.IgnoreConfig) count.IgnoreConfig {
 	if ign == nil {
-		ignoreCfg = count.DefaultIgnoreConfig()
-	} else {
-		ignoreCfg = *ign
+		return count.DefaultIgnoreConfig()
 	}
+	return *ign
+}
 
+func newRootModel(header headerModel, scanner *count.Scanner, ignoreCfg count.IgnoreConfig, opts count.Options) rootModel {
+	ctx, cancel := opts.Context(context.Background())
 	return rootModel{
-		header:           newHeaderModel(rootfs),
-		lineContent:      newLineContentModel(),
-		blameContent:     newBlameContentModel(),
-		footer:           newFooterModel(),
-		errors:           []error{},
-		activePanel:      0,
-		sortBy:           SortTypeAlphabetical,
-		fileIgnoreConfig: ignoreCfg,
+		header:       header,
+		lineContent:  newLineContentModel(),
+		dirContent:   newDirContentModel(),
+		blameContent: newBlameContentModel(),
+		footer:       newFooterModel(),
+		errorPanel:   newErrorPanelModel(header.path),
+		errors:       []error{},
+		activePanel:  0,
+		sortBy:       SortTypeAlphabetical,
+		options:      opts,
+		ignore:       ignoreCfg,
+		scanner:      scanner,
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 }
 
-// Wait for and return the next message from BlameStatusChannel.
+// Wait for and return the next message from the scanner's status channel.
 // tea.Cmds run as a goroutine, so we can block here and wait for the next message.
-func subscribeBlameStatus() tea.Cmd {
+// Stops waiting once the scan is cancelled.
+func subscribeBlameStatus(ctx context.Context, s *count.Scanner) tea.Cmd {
 	return func() tea.Msg {
-		return <-count.BlameStatusChannel
+		select {
+		case msg := <-s.Status():
+			return msg
+		case <-ctx.Done():
+			return nil
+		}
 	}
 }
 
 // Ran on initialization. Kick off the file walk
 func (r rootModel) Init() tea.Cmd {
+	if r.batch != nil {
+		return prepareRepo(r.ctx, r.batch, 0)
+	}
+	return r.scanner.StartWalk(r.ctx)
+}
+
+// Msg containing the scanner of a batch repository, ready to be walked
+type repoReadyMsg struct {
+	index   int
+	scanner *count.Scanner
+	err     error
+}
+
+// Command to create the scanner of the i-th repository of the batch,
+// which clones it first if it was given by URL
+func prepareRepo(ctx context.Context, batch *count.Batch, i int) tea.Cmd {
 	return func() tea.Msg {
-		return count.Walk(r.header.path, r.fileIgnoreConfig)
+		scanner, err := batch.Scanner(ctx, i)
+		return repoReadyMsg{index: i, scanner: scanner, err: err}
 	}
 }
 
+// finishRepo records the result of the repository being scanned, then
+// moves on to the next one. Once every repository is scanned, or the
+// scan timed out, the aggregate of all of them is shown.
+func (r *rootModel) finishRepo(res *count.Result, err error) tea.Cmd {
+	r.batch.SetResult(r.selector.scanning, res, err)
+	r.selector.scanning++
+	if !r.selector.Done() && r.ctx.Err() == nil {
+		repo := r.batch.Repos[r.selector.scanning]
+		r.header.showRepo(repo, len(r.batch.Repos))
+		r.footer.status = fmt.Sprintf("Scanning %s (%d / %d)...", repo.Name, r.selector.scanning+1, len(r.batch.Repos))
+		return tea.Batch(prepareRepo(r.ctx, r.batch, r.selector.scanning), r.footer.spinner.Tick)
+	}
+
+	r.selector.scanning = len(r.batch.Repos)
+	r.batch.Combine()
+	return r.showRepo(0)
+}
+
+// showRepo shows entry i of the repository selector in the panels,
+// the aggregate for 0. Results are tallied again with the current date
+// range and grouping, which may have changed since they were blamed.
+func (r *rootModel) showRepo(i int) tea.Cmd {
+	res := r.selector.result(i)
+	if res == nil {
+		return nil
+	}
+	r.selector.selected = i
+	var repo *count.BatchRepo
+	if i > 0 {
+		repo = r.batch.Repos[i-1]
+	}
+	r.header.showRepo(repo, len(r.batch.Repos))
+	res.TallyBlame(r.options.DateRange, r.options.GroupBy)
+	r.result = res
+	return count.ShowResult(res)
+}
+
+// rescan cancels the in-flight scan and starts over with a new scanner,
+// so date range and grouping changes carry over to the new results.
+func (r *rootModel) rescan() tea.Cmd {
+	r.cancel()
+	r.ctx, r.cancel = r.options.Context(context.Background())
+	r.result = nil
+	r.blameDone = false
+	r.footer.summary = ""
+	if r.batch != nil {
+		r.batch = r.batch.With(r.ignore, r.options)
+		r.selector = newRepoSelectorModel(r.batch)
+		r.header.showRepo(r.batch.Repos[0], len(r.batch.Repos))
+		r.footer.status = fmt.Sprintf("Scanning %s (1 / %d)...", r.batch.Repos[0].Name, len(r.batch.Repos))
+		return tea.Batch(prepareRepo(r.ctx, r.batch, 0), r.footer.spinner.Tick)
+	}
+	r.scanner = r.scanner.With(r.ignore, r.options)
+	r.footer.status = "Walking directory..."
+	return tea.Batch(r.scanner.StartWalk(r.ctx), r.footer.spinner.Tick)
+}
+
+// scanningBatch reports whether the repositories of a batch are still
+// being scanned, rather than a finished result being shown.
+func (r rootModel) scanningBatch() bool {
+	return r.batch != nil && !r.selector.Done()
+}
+
 func (r rootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
 	// Handle messages based on message type
+	// Batches move on to the next repository once the panels and
+	// footer have been updated with the last one
+	repoDone := false
+
 	switch m := msg.(type) {
+	case repoReadyMsg:
+		// Repositories that couldn't be cloned are skipped
+		if m.err != nil {
+			return r, r.finishRepo(nil, m.err)
+		}
+		r.scanner = m.scanner
+		cmds = append(cmds, r.scanner.StartWalk(r.ctx))
 	case count.WalkDoneMsg:
-		cmds = append(cmds, subscribeBlameStatus(), count.StartBlameRepo(r.header.path))
+		r.result = m.Result
+		// Shown batch results are already blamed
+		if r.batch == nil || r.scanningBatch() {
+			cmds = append(cmds, subscribeBlameStatus(r.ctx, r.scanner), r.scanner.StartBlame(r.ctx, m.Result))
+		}
 	case count.WalkErrorMsg:
+		// Cancelled walks were replaced by a rescan
+		if errors.Is(m.Err, context.Canceled) {
+			break
+		}
+		if r.scanningBatch() {
+			return r, r.finishRepo(nil, m.Err)
+		}
 		r.errors = append(r.errors, m.Err)
 	case count.BlameStatusMsg:
 		// Must resubscribe to the channel to get the next message
-		cmds = append(cmds, subscribeBlameStatus())
+		cmds = append(cmds, subscribeBlameStatus(r.ctx, r.scanner))
+	case count.BlameDoneMsg:
+		if r.scanningBatch() {
+			repoDone = true
+			break
+		}
+		r.blameDone = true
+		r.options.DateRange = m.DateRange
+		r.options.GroupBy = m.GroupBy
 	case count.BlameErrorMsg:
+		if errors.Is(m.Err, context.Canceled) {
+			break
+		}
+		// Directories listed in a batch may not be repositories
+		if r.scanningBatch() {
+			if errors.Is(m.Err, git.ErrRepositoryNotExists) {
+				m.Err = nil
+			}
+			return r, r.finishRepo(r.result, m.Err)
+		}
 		if !errors.Is(m.Err, git.ErrRepositoryNotExists) {
 			r.errors = append(r.errors, m.Err)
 		}
 	case tea.KeyMsg:
+		// While the repository selector is open it receives all keys
+		if r.selector.visible {
+			switch m.String() {
+			case "ctrl+c", "q":
+				r.cancel()
+				return r, tea.Quit
+			case "esc", "p":
+				r.selector.visible = false
+			case "up", "k":
+				r.selector.moveCursor(-1)
+			case "down", "j":
+				r.selector.moveCursor(1)
+			case "enter", " ":
+				if r.selector.Done() {
+					r.selector.visible = false
+					return r, r.showRepo(r.selector.cursor)
+				}
+			}
+			return r, nil
+		}
+
+		// While the date range input is open it receives all keys
+		if r.footer.editingRange {
+			switch m.String() {
+			case "ctrl+c":
+				r.cancel()
+				return r, tea.Quit
+			case "esc":
+				r.footer.stopRangeInput()
+			case "enter":
+				dateRange, err := count.ParseDateRangeString(r.footer.rangeInput.Value())
+				if err != nil {
+					r.footer.rangeInput.Placeholder = err.Error()
+					r.footer.rangeInput.SetValue("")
+					break
+				}
+				r.footer.stopRangeInput()
+				r.options.DateRange = dateRange
+				cmds = append(cmds, count.RetallyBlame(r.result, r.options.DateRange, r.options.GroupBy))
+			default:
+				cmds = append(cmds, r.footer.Update(msg, r.windowWidth))
+			}
+			return r, tea.Batch(cmds...)
+		}
+
 		// Handle key events
 		switch m.String() {
 		case "ctrl+c", "q", "esc":
+			// Stop in-flight work so workers don't outlive the program
+			r.cancel()
 			return r, tea.Quit
+		case "r":
+			cmds = append(cmds, r.rescan())
+		case "p":
+			// Open the repository selector of a batch
+			if r.batch != nil {
+				r.selector.visible = true
+				r.selector.cursor = r.selector.selected
+			}
 		case "left", "right":
 			//Switch between panels if the window is in single panel mode
 			if r.windowWidth <= SINGLE_PANEL_WIDTH {
@@ -108,6 +339,24 @@ func (r rootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					cmds = append(cmds, SetActivePanel(0))
 				}
 			}
+		case "d":
+			// Open the date range input once blame results are available
+			// Return early so the key isn't typed into the input
+			if r.blameDone {
+				return r, r.footer.startRangeInput(r.options.DateRange)
+			}
+		case "g":
+			// Cycle how authors are grouped once blame results are available
+			if r.blameDone {
+				r.options.GroupBy = r.options.GroupBy.Next()
+				cmds = append(cmds, count.RetallyBlame(r.result, r.options.DateRange, r.options.GroupBy))
+			}
+		case "t":
+			// Toggle between filetype line counts and the directory tree
+			r.showTree = !r.showTree
+			if r.dirContent.ready {
+				r.dirContent.viewport.SetContent(r.dirContent.generateContent())
+			}
 		case "s":
 			// Toggle global sort type
 			if r.sortBy == SortTypeAlphabetical {
@@ -121,6 +370,10 @@ func (r rootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if r.lineContent.ready {
 				r.lineContent.viewport.SetContent(r.lineContent.generateContent())
 			}
+			r.dirContent.sortBy = r.sortBy
+			if r.dirContent.ready {
+				r.dirContent.viewport.SetContent(r.dirContent.generateContent())
+			}
 			r.blameContent.sortBy = r.sortBy
 			if r.blameContent.ready {
 				r.blameContent.viewport.SetContent(r.blameContent.generateContent())
@@ -147,17 +400,27 @@ func (r rootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		r.rightWidth = rightWidth
 	}
 
-	// forward the message to all models
+	// forward the message to all models, keys only go to the
+	// visible one of the line content and directory tree
+	leftWidth, rightWidth := r.leftWidth, r.rightWidth
 	if r.windowWidth <= SINGLE_PANEL_WIDTH {
-		cmds = append(cmds, r.lineContent.Update(msg, r.windowWidth, r.contentHeight))
-		cmds = append(cmds, r.blameContent.Update(msg, r.windowWidth, r.contentHeight))
-	} else {
-		cmds = append(cmds, r.lineContent.Update(msg, r.leftWidth, r.contentHeight))
-		cmds = append(cmds, r.blameContent.Update(msg, r.rightWidth, r.contentHeight))
+		leftWidth, rightWidth = r.windowWidth, r.windowWidth
+	}
+	_, isKey := msg.(tea.KeyMsg)
+	if !isKey || !r.showTree {
+		cmds = append(cmds, r.lineContent.Update(msg, leftWidth, r.contentHeight))
 	}
+	if !isKey || r.showTree {
+		cmds = append(cmds, r.dirContent.Update(msg, leftWidth, r.contentHeight))
+	}
+	cmds = append(cmds, r.blameContent.Update(msg, rightWidth, r.contentHeight))
 	cmds = append(cmds, r.footer.Update(msg, r.windowWidth))
 	cmds = append(cmds, r.header.Update(msg, r.windowWidth))
+	r.errorPanel.Update(msg)
 
+	if repoDone {
+		cmds = append(cmds, r.finishRepo(r.result, nil))
+	}
 	return r, tea.Batch(cmds...)
 }
 
@@ -170,12 +433,22 @@ func (r rootModel) View() string {
 	// Get the views from all models
 	headerView := r.header.View()
 	footerView := footerMargin.Render(r.footer.View())
-	lineContentView := lineContentMargin.Render(r.lineContent.View())
+	var lineContentView string
+	if r.showTree {
+		lineContentView = lineContentMargin.Render(r.dirContent.View())
+	} else {
+		lineContentView = lineContentMargin.Render(r.lineContent.View())
+	}
 	blameContentView := blameContentMargin.Render(r.blameContent.View())
 
-	// If the window is too small, show only one content panel
+	// Files that couldn't be read are shown in place of the content
+	// until dismissed. If the window is too small, show only one content panel
 	var contentRow string
-	if r.windowWidth <= SINGLE_PANEL_WIDTH {
+	if r.selector.visible {
+		contentRow = r.selector.View(r.windowWidth, r.contentHeight)
+	} else if r.errorPanel.Visible() {
+		contentRow = r.errorPanel.View(r.windowWidth, r.contentHeight)
+	} else if r.windowWidth <= SINGLE_PANEL_WIDTH {
 		if r.activePanel == 0 {
 			contentRow = lineContentView
 		} else {